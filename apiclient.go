@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lair-framework/api-server/client"
+	"github.com/lair-framework/go-lair"
+)
+
+// lairAPI is the part of the lair API client the drone uses, so the server can also be reached
+// through apiClient when it requires client certificates or a -request-timeout
+type lairAPI interface {
+	ExportProject(id string) (lair.Project, error)
+	ImportProject(opts *client.DOptions, project *lair.Project) (*http.Response, error)
+}
+
+// apiClient talks to the lair API server like client.C does, but on an http.Client of its own. the upstream
+// client builds its own TLS config and has no timeout, so it can't present a client certificate for mutual
+// TLS or put a deadline on a request
+type apiClient struct {
+	user     string
+	password string
+	host     string
+	scheme   string
+	http     *http.Client
+}
+
+// loadClientCert loads the -client-cert and -client-key pair, failing clearly if they don't belong together
+func loadClientCert(certFile, keyFile string) (*tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("-client-cert and -client-key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// newAPIClient makes an apiClient, cert may be nil and a timeout of 0 leaves requests unbounded. the timeout
+// covers the whole request, reading the response body included, and cancels it when it runs out
+func newAPIClient(user, password string, u *url.URL, insecureSSL bool, cert *tls.Certificate, timeout time.Duration) *apiClient {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSSL}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+	return &apiClient{
+		user:     user,
+		password: password,
+		host:     u.Host,
+		scheme:   u.Scheme,
+		http: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+}
+
+func (c *apiClient) projectURL(id string) *url.URL {
+	return &url.URL{Scheme: c.scheme, Host: c.host, Path: fmt.Sprintf("/api/projects/%s", id)}
+}
+
+// ExportProject fetches the project from the API server
+func (c *apiClient) ExportProject(id string) (lair.Project, error) {
+	project := lair.Project{}
+	req, err := http.NewRequest("GET", c.projectURL(id).String(), nil)
+	if err != nil {
+		return project, err
+	}
+	req.SetBasicAuth(c.user, c.password)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return project, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return project, fmt.Errorf("non-200 status code %s", res.Status)
+	}
+	err = json.NewDecoder(res.Body).Decode(&project)
+	return project, err
+}
+
+// ImportProject sends the project to the API server, the caller reads the drone response from the body
+func (c *apiClient) ImportProject(opts *client.DOptions, project *lair.Project) (*http.Response, error) {
+	body, err := json.Marshal(project)
+	if err != nil {
+		return nil, err
+	}
+	u := c.projectURL(project.ID)
+	q := u.Query()
+	if opts.ForcePorts {
+		q.Set("force-ports", "true")
+	}
+	if opts.LimitHosts {
+		q.Set("limit-hosts", "true")
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("PATCH", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.user, c.password)
+	req.Header.Set("Content-Type", "application/json")
+	return c.http.Do(req)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lair-framework/api-server/client"
+	"github.com/lair-framework/go-lair"
+)
+
+// testCert is a certificate with its key, as PEM, signed by parent or self signed when parent is nil
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeCert writes the certificate and key to files and returns their names
+func (c *testCert) write(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certFile, c.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, c.keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// mtlsServer is a lair API server that only talks to clients with a certificate signed by ca
+func mtlsServer(t *testing.T, ca *testCert, handler http.Handler) *url.URL {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	s := httptest.NewUnstartedServer(handler)
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestMTLSClientExportAndImport(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	var imported lair.Project
+	var query url.Values
+	u := mtlsServer(t, ca, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "u" || password != "p" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/projects/p1" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(lair.Project{ID: "p1", Tool: "lair"})
+		case "PATCH":
+			query = r.URL.Query()
+			json.NewDecoder(r.Body).Decode(&imported)
+			w.Write([]byte(`{"Status":"Ok","Message":""}`))
+		}
+	}))
+	cert, err := loadClientCert(newTestCert(t, "drone", ca).write(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server certificate is httptest's own, only the client side is under test
+	c := newAPIClient("u", "p", u, true, cert, 0)
+	project, err := c.ExportProject("p1")
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if project.ID != "p1" {
+		t.Errorf("exported project %q, want p1", project.ID)
+	}
+	res, err := c.ImportProject(&client.DOptions{ForcePorts: true}, &lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}}})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	res.Body.Close()
+	if len(imported.Hosts) != 1 || imported.Hosts[0].IPv4 != "1.2.3.4" {
+		t.Errorf("the server got %+v", imported)
+	}
+	if query.Get("force-ports") != "true" || query.Get("limit-hosts") != "" {
+		t.Errorf("the server got query %v", query)
+	}
+}
+
+func TestMTLSClientUntrustedCertificate(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	u := mtlsServer(t, ca, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a client with an untrusted certificate got through")
+	}))
+	other := newTestCert(t, "other ca", nil)
+	cert, err := loadClientCert(newTestCert(t, "drone", other).write(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAPIClient("u", "p", u, true, cert, 0).ExportProject("p1"); err == nil {
+		t.Fatal("expected the handshake to fail")
+	}
+}
+
+func TestLoadClientCert(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	certFile, _ := newTestCert(t, "drone", ca).write(t)
+	_, otherKey := newTestCert(t, "other", ca).write(t)
+	if _, err := loadClientCert(certFile, ""); err == nil {
+		t.Error("expected an error for a certificate without a key")
+	}
+	if _, err := loadClientCert(certFile, otherKey); err == nil {
+		t.Error("expected an error for a key that doesn't belong to the certificate")
+	}
+}
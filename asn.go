@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// asnNumber is an ASN in canonical decimal form, without an AS prefix or leading zeros. amass writes ASNs as
+// json numbers, but other tools and older versions write them as strings, and some values don't fit an int,
+// so they are kept as text instead of being silently truncated. the zero value is an unknown ASN
+type asnNumber string
+
+// parseASN canonicalizes an ASN written like "12345", "AS12345" or "as012345". 0 is an unknown ASN like in amass
+func parseASN(s string) (asnNumber, error) {
+	digits := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "AS")
+	if digits == "" {
+		return "", errors.New("empty ASN")
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("%q is not a number", s)
+		}
+	}
+	return asnNumber(strings.TrimLeft(digits, "0")), nil
+}
+
+// UnmarshalJSON accepts the ASN as a json number or string, null and "" are an unknown ASN
+func (a *asnNumber) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*a = ""
+		return nil
+	}
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if strings.TrimSpace(s) == "" {
+			*a = ""
+			return nil
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		s = n.String()
+	}
+	asn, err := parseASN(s)
+	if err != nil {
+		return fmt.Errorf("invalid ASN: %w", err)
+	}
+	*a = asn
+	return nil
+}
+
+// MarshalJSON writes the ASN back as a json number, like amass does
+func (a asnNumber) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// String is the ASN in decimal, an unknown ASN is 0 like it is in amass output and in lair
+func (a asnNumber) String() string {
+	if a == "" {
+		return "0"
+	}
+	return string(a)
+}
+
+// the -asn-format values, how ASNs are written into lair netblocks
+const (
+	asnFormatNumber = "number"
+	asnFormatPrefix = "as"
+)
+
+// format is the ASN as it is stored in lair, 12345 or AS12345. an unknown ASN is 0 either way
+func (a asnNumber) format(style string) string {
+	if a == "" || style != asnFormatPrefix {
+		return a.String()
+	}
+	return "AS" + string(a)
+}
+
+// less orders ASNs numerically, they are canonical so a shorter ASN is always the smaller one
+func (a asnNumber) less(b asnNumber) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// asnEntry is a prefix of the -asn-lookup dataset with the ASN that announces it
+type asnEntry struct {
+	asn  asnNumber
+	desc string
+}
+
+// asnTable is the -asn-lookup dataset, prefixes keyed by their length and then by network address
+// so a lookup is one map probe per prefix length instead of a scan over the whole dataset
+type asnTable map[int]map[string]asnEntry
+
+// parseASNTable reads the dataset, one "cidr asn description" per line like the text input format
+// without the name. the ASN may be written with or without an AS prefix and # starts a comment
+func parseASNTable(data []byte) (asnTable, error) {
+	t := asnTable{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a cidr and an asn", i+1)
+		}
+		_, network, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		asn, err := parseASN(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid ASN: %w", i+1, err)
+		}
+		ones, _ := network.Mask.Size()
+		if t[ones] == nil {
+			t[ones] = map[string]asnEntry{}
+		}
+		t[ones][network.IP.String()] = asnEntry{asn: asn, desc: strings.Join(fields[2:], " ")}
+	}
+	return t, nil
+}
+
+// loadASNTable reads the -asn-lookup dataset from a file or a URL. a downloaded dataset is cached, so a run
+// that can't reach the URL, e.g. on an offline engagement network, uses the copy from the last one that could
+func loadASNTable(name string, fetch fetchOptions) (asnTable, error) {
+	if !isURL(name) {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return nil, errors.New("the file doesn't exist, -asn-lookup needs a file of \"cidr asn description\" lines, see ASN lookup in the README")
+		}
+		data, err := readInput(name, fetch)
+		if err != nil {
+			return nil, err
+		}
+		return parseASNTable(data)
+	}
+	cache, cacheErr := asnCacheFile(name)
+	data, fetchErr := readInput(name, fetch)
+	if fetchErr == nil {
+		t, err := parseASNTable(data)
+		if err != nil {
+			return nil, err
+		}
+		if cacheErr == nil {
+			cacheErr = writeASNCache(cache, data)
+		}
+		if cacheErr != nil {
+			warnf("Could not cache the -asn-lookup dataset, the next run needs the download to work. Error %s", cacheErr.Error())
+		}
+		return t, nil
+	}
+	if cacheErr != nil {
+		return nil, fmt.Errorf("could not download it and there is no cache to fall back on (%s): %w", cacheErr.Error(), fetchErr)
+	}
+	info, err := os.Stat(cache)
+	if err != nil {
+		return nil, fmt.Errorf("could not download it and it was never cached: %w", fetchErr)
+	}
+	cached, err := ioutil.ReadFile(cache)
+	if err != nil {
+		return nil, fmt.Errorf("could not download it or read the cached copy: %w", err)
+	}
+	warnf("Could not download the -asn-lookup dataset, using the copy cached on %s. Error %s", info.ModTime().Format("2006-01-02 15:04"), fetchErr.Error())
+	return parseASNTable(cached)
+}
+
+// asnCacheFile is where a downloaded -asn-lookup dataset is kept, in the user cache directory and named after
+// a hash of the URL so presigned URLs don't end up in file names
+func asnCacheFile(rawURL string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, "drone-amass", "asn-"+hex.EncodeToString(sum[:8])+".txt"), nil
+}
+
+// writeASNCache replaces the cached dataset. it is written next to the old one first, so a run that is
+// killed halfway never leaves a truncated cache behind
+func writeASNCache(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// lookup returns the entry of the most specific prefix that contains ip
+func (t asnTable) lookup(ip string) (asnEntry, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return asnEntry{}, false
+	}
+	bits := 128
+	if v4 := addr.To4(); v4 != nil {
+		addr, bits = v4, 32
+	}
+	for ones := bits; ones >= 0; ones-- {
+		networks, ok := t[ones]
+		if !ok {
+			continue
+		}
+		if e, ok := networks[addr.Mask(net.CIDRMask(ones, bits)).String()]; ok {
+			return e, true
+		}
+	}
+	return asnEntry{}, false
+}
+
+// enrichASNs fills in the ASN and description of addresses that have a CIDR but are missing either.
+// whatever amass did report is never overwritten. it returns how many addresses were enriched
+func enrichASNs(results []amassResult, t asnTable) int {
+	enriched := 0
+	for i := range results {
+		for j := range results[i].Addresses {
+			a := &results[i].Addresses[j]
+			if a.Cidr == "" || (a.Asn != "" && a.Desc != "") {
+				continue
+			}
+			ip := a.IP
+			if ip == "" {
+				ip = strings.Split(a.Cidr, "/")[0]
+			}
+			e, ok := t.lookup(ip)
+			// a description from a different ASN than the one amass reported would be wrong
+			if !ok || (a.Asn != "" && a.Asn != e.asn) {
+				continue
+			}
+			if a.Asn == "" {
+				a.Asn = e.asn
+			}
+			if a.Desc == "" {
+				a.Desc = e.desc
+			}
+			enriched++
+		}
+	}
+	return enriched
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestASNNumberUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want asnNumber
+	}{
+		{`13335`, "13335"},
+		{`"13335"`, "13335"},
+		{`"AS13335"`, "13335"},
+		{`" as013335 "`, "13335"},
+		{`99999999999999999999999`, "99999999999999999999999"},
+		{`0`, ""},
+		{`"AS0"`, ""},
+		{`null`, ""},
+		{`""`, ""},
+	}
+	for _, tt := range tests {
+		var got asnNumber
+		if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+			t.Errorf("%s: unexpected error %v", tt.json, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestASNNumberUnmarshalJSONInvalid(t *testing.T) {
+	for _, data := range []string{`1.5`, `-1`, `"AS"`, `"12a"`, `true`, `{}`} {
+		var got asnNumber
+		if err := json.Unmarshal([]byte(data), &got); err == nil {
+			t.Errorf("%s: got %q, want an error", data, got)
+		}
+	}
+}
+
+func TestASNNumberRoundTrip(t *testing.T) {
+	out, err := json.Marshal(amassAddress{IP: "1.2.3.4", Asn: "99999999999999999999999"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back amassAddress
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Asn != "99999999999999999999999" {
+		t.Errorf("got %q back from %s", back.Asn, out)
+	}
+	if out, _ := json.Marshal(asnNumber("")); string(out) != "0" {
+		t.Errorf("an unknown ASN marshals to %s, want 0", out)
+	}
+}
+
+func TestASNNumberFormatAndOrder(t *testing.T) {
+	if got := asnNumber("13335").format(asnFormatPrefix); got != "AS13335" {
+		t.Errorf("got %s, want AS13335", got)
+	}
+	if got := asnNumber("").format(asnFormatPrefix); got != "0" {
+		t.Errorf("an unknown ASN formats as %s, want 0", got)
+	}
+	if !asnNumber("9").less("10") || asnNumber("10").less("9") {
+		t.Error("ASNs don't order numerically")
+	}
+}
+
+func TestParseJsonLinesASNFixture(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/asn.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := collect(t, parseJsonLines, data)
+	asns := []asnNumber{}
+	for _, r := range results {
+		asns = append(asns, r.Addresses[0].Asn)
+	}
+	want := []asnNumber{"13335", "13335", "99999999999999999999999", "", ""}
+	if !reflect.DeepEqual(asns, want) {
+		t.Errorf("got %q, want %q", asns, want)
+	}
+	// a fractional ASN is a bad line, not a truncated number
+	var bad lineErrors
+	if !errors.As(err, &bad) || len(bad) != 1 {
+		t.Fatalf("got error %v, want the one bad line", err)
+	}
+}
+
+const testASNDataset = `# cidr asn description
+1.2.3.0/24   AS100  Example Net
+1.2.0.0/16   200    Wider Net
+`
+
+func TestEnrichASNs(t *testing.T) {
+	table, err := parseASNTable([]byte(testASNDataset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []amassResult{{Name: "www.example.com", Addresses: []amassAddress{
+		{IP: "1.2.3.4", Cidr: "1.2.3.0/24"},
+		{IP: "1.2.9.9", Cidr: "1.2.0.0/16", Asn: "200"},
+		{IP: "1.2.3.5", Cidr: "1.2.3.0/24", Asn: "300"},
+		{IP: "1.2.3.6", Cidr: "1.2.3.0/24", Asn: "100", Desc: "Amass Net"},
+		{IP: "1.2.3.7"},
+	}}}
+	if n := enrichASNs(results, table); n != 2 {
+		t.Errorf("enriched %d addresses, want 2", n)
+	}
+	// an ASN other than the dataset's keeps its empty description, what amass reported is never overwritten
+	want := []amassAddress{
+		{IP: "1.2.3.4", Cidr: "1.2.3.0/24", Asn: "100", Desc: "Example Net"},
+		{IP: "1.2.9.9", Cidr: "1.2.0.0/16", Asn: "200", Desc: "Wider Net"},
+		{IP: "1.2.3.5", Cidr: "1.2.3.0/24", Asn: "300"},
+		{IP: "1.2.3.6", Cidr: "1.2.3.0/24", Asn: "100", Desc: "Amass Net"},
+		{IP: "1.2.3.7"},
+	}
+	if !reflect.DeepEqual(results[0].Addresses, want) {
+		t.Errorf("got %+v, want %+v", results[0].Addresses, want)
+	}
+}
+
+func TestLoadASNTableCachesDownloads(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	s := httptest.NewServer(serveInput([]byte(testASNDataset)))
+	name := s.URL + "/results.json?X-Amz-Signature=abc"
+	fetch := fetchOptions{timeout: 5 * time.Second}
+	if _, err := loadASNTable(name, fetch); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// offline, the copy from the last download is used
+	s.Close()
+	table, err := loadASNTable(name, fetch)
+	if err != nil {
+		t.Fatalf("unexpected error without the server %v", err)
+	}
+	if e, ok := table.lookup("1.2.3.4"); !ok || e.asn != "100" {
+		t.Errorf("the cached dataset has %+v for 1.2.3.4", e)
+	}
+	if _, err := loadASNTable(s.URL+"/other.json", fetch); err == nil || !strings.Contains(err.Error(), "never cached") {
+		t.Errorf("got %v for a URL that was never downloaded, want it to say there is no cache", err)
+	}
+}
+
+func TestLoadASNTableMissingFile(t *testing.T) {
+	_, err := loadASNTable(filepath.Join(t.TempDir(), "asn.txt"), fetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "doesn't exist") {
+		t.Errorf("got %v, want it to say the file doesn't exist", err)
+	}
+}
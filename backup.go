@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lair-framework/api-server/client"
+	"github.com/lair-framework/go-lair"
+)
+
+// backupProject writes the project as it was exported, before anything is merged into it, to a timestamped
+// file in dir so a bad run can be rolled back with -restore. it returns the name of the file
+func backupProject(dir, id string, project interface{}, t time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(project, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s.json", filepath.Base(id), t.UTC().Format("20060102T150405Z")))
+	// the backup has everything lair knows about the project, keep it private
+	return name, ioutil.WriteFile(name, data, 0600)
+}
+
+// restore implements -restore, it imports a -project-backup file back into lair to roll back a bad run.
+// like -delete-missing it only shows what it would do unless -force is given. lair merges imports, the
+// same way it keeps the hostnames -delete-missing leaves out, so whatever the bad run changed comes back
+// but anything it added stays
+func restore(opts options, args []string) error {
+	data, err := ioutil.ReadFile(opts.restore)
+	if err != nil {
+		return fmt.Errorf("restore: could not read backup: %w", err)
+	}
+	var project lair.Project
+	if err := json.Unmarshal(data, &project); err != nil {
+		return fmt.Errorf("restore: %s is not a lair project: %w", opts.restore, err)
+	}
+	if project.ID == "" {
+		return fmt.Errorf("restore: %s is not a lair project backup, it has no project id", opts.restore)
+	}
+	// a project id given the usual way has to agree with the backup, so a backup can't land in the wrong project
+	lairPID := os.Getenv("LAIR_ID")
+	if len(args) > 0 {
+		lairPID = args[0]
+	}
+	if lairPID != "" && lairPID != project.ID {
+		return fmt.Errorf("restore: %s is a backup of project %s, not %s", opts.restore, project.ID, lairPID)
+	}
+	log.Printf("Info: %s is a backup of project %s with %d hosts and %d netblocks", opts.restore, project.ID, len(project.Hosts), len(project.Netblocks))
+	if !opts.force {
+		log.Println("Info: -restore preview only, nothing was imported. Re-run with -force to import the backup")
+		return nil
+	}
+	lairClient, err := connectLair(opts)
+	if err != nil {
+		return err
+	}
+	imp := &importer{
+		client:  lairClient,
+		options: &client.DOptions{ForcePorts: opts.forcePorts},
+		delay:   opts.importDelay,
+		order:   opts.importOrder,
+	}
+	if err := imp.importBatches(&project, opts.batchSize); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return nil
+}
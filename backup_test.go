@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+func TestBackupThenRestore(t *testing.T) {
+	exported := lair.Project{
+		ID:        "p1",
+		Hosts:     []lair.Host{{ID: "h1", ProjectID: "p1", IPv4: "1.2.3.4", Hostnames: []string{"www.example.com"}, Tags: []string{"dmz"}}},
+		Netblocks: []lair.Netblock{{ID: "n1", ProjectID: "p1", ASN: "13335", CIDR: "1.2.3.0/24", Description: "Example Net"}},
+	}
+	s, imports := lairServer(t, exported, "Ok")
+	t.Setenv("LAIR_API_SERVER", withCredentials(s.URL))
+	input := filepath.Join(t.TempDir(), "amass.json")
+	if err := ioutil.WriteFile(input, []byte(`{"name":"new.example.com","addresses":[{"ip":"1.2.3.4"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	opts.projectBackup = t.TempDir()
+	if err := run(opts, []string{"p1", input}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	backups, err := filepath.Glob(filepath.Join(opts.projectBackup, "p1-*.json"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("got backups %v (%v), want one", backups, err)
+	}
+
+	// without -force only the preview runs
+	opts = testOptions()
+	opts.restore = backups[0]
+	if err := restore(opts, nil); err != nil {
+		t.Fatalf("preview: unexpected error %v", err)
+	}
+	if len(*imports) != 1 {
+		t.Fatalf("the preview imported something, got %d imports", len(*imports))
+	}
+	opts.force = true
+	if err := restore(opts, []string{"p2"}); err == nil || !strings.Contains(err.Error(), "not p2") {
+		t.Fatalf("got %v, want the backup refused for another project", err)
+	}
+	if err := restore(opts, []string{"p1"}); err != nil {
+		t.Fatalf("restore: unexpected error %v", err)
+	}
+	if len(*imports) != 2 {
+		t.Fatalf("got %d imports, want the run and the restore", len(*imports))
+	}
+	if restored := (*imports)[1]; !reflect.DeepEqual(restored, exported) {
+		t.Errorf("restored %+v, want the project as it was exported %+v", restored, exported)
+	}
+}
+
+func TestRestoreRejectsNonProjects(t *testing.T) {
+	dir := t.TempDir()
+	for _, data := range []string{`not json`, `{"hosts":[]}`} {
+		filename := filepath.Join(dir, "backup.json")
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		opts := testOptions()
+		opts.restore = filename
+		opts.force = true
+		if err := restore(opts, nil); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// checkpoint is the -resume file, it records which hosts and netblocks of an import made it into lair so a
+// rerun after an interrupted import only sends the rest. records are tracked rather than batches because the
+// rerun exports the project again, which can move hosts between batches. the checkpoint belongs to one project
+// and one input file, it is ignored for anything else, and it is removed once an import completes
+type checkpoint struct {
+	path      string
+	ProjectID string   `json:"projectId"`
+	Input     string   `json:"input"`
+	Hosts     []string `json:"hosts"`
+	Netblocks []string `json:"netblocks"`
+	Updated   string   `json:"updated"`
+}
+
+// inputDigest identifies the results file a checkpoint was made for
+func inputDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCheckpoint reads the checkpoint at path for this project and input. a missing file starts a new one,
+// and so does one that is corrupt or was made for another project or input, with a warning
+func loadCheckpoint(path, projectID, input string) *checkpoint {
+	fresh := &checkpoint{path: path, ProjectID: projectID, Input: input}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fresh
+	}
+	if err != nil {
+		warnf("Could not read checkpoint %s, importing everything. Error %s", path, err.Error())
+		return fresh
+	}
+	c := &checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		warnf("Checkpoint %s is corrupt, importing everything. Error %s", path, err.Error())
+		return fresh
+	}
+	if c.ProjectID != projectID || c.Input != input {
+		warnf("Checkpoint %s is from another project or results file, importing everything", path)
+		return fresh
+	}
+	c.path = path
+	return c
+}
+
+// skip returns a copy of the project without the hosts and netblocks the checkpoint has as imported
+func (c *checkpoint) skip(project *lair.Project) *lair.Project {
+	hosts := map[string]bool{}
+	for _, ip := range c.Hosts {
+		hosts[ip] = true
+	}
+	netblocks := map[string]bool{}
+	for _, cidr := range c.Netblocks {
+		netblocks[cidr] = true
+	}
+	rest := &lair.Project{ID: project.ID, Tool: project.Tool, Commands: project.Commands}
+	for _, h := range project.Hosts {
+		if !hosts[h.IPv4] {
+			rest.Hosts = append(rest.Hosts, h)
+		}
+	}
+	for _, n := range project.Netblocks {
+		if !netblocks[n.CIDR] {
+			rest.Netblocks = append(rest.Netblocks, n)
+		}
+	}
+	return rest
+}
+
+// record adds a batch lair accepted to the checkpoint and saves it. the file is replaced in one rename so an
+// interruption while saving leaves the previous checkpoint rather than a corrupt one
+func (c *checkpoint) record(batch *lair.Project) error {
+	for _, h := range batch.Hosts {
+		c.Hosts = append(c.Hosts, h.IPv4)
+	}
+	for _, n := range batch.Netblocks {
+		c.Netblocks = append(c.Netblocks, n.CIDR)
+	}
+	c.Updated = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// finish removes the checkpoint after a complete import, there is nothing left to resume
+func (c *checkpoint) finish() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
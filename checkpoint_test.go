@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// rejectingLair is a lair API server holding project that refuses every import with a host in reject, and
+// keeps the host IPs of each import it accepted
+func rejectingLair(t *testing.T, project lair.Project, reject map[string]bool) (*httptest.Server, *[][]string) {
+	t.Helper()
+	accepted := [][]string{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(project)
+			return
+		}
+		var p lair.Project
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("could not decode import: %v", err)
+		}
+		ips := []string{}
+		for _, h := range p.Hosts {
+			if reject[h.IPv4] {
+				fmt.Fprintf(w, `{"Status":"Error","Message":"bad host %s"}`, h.IPv4)
+				return
+			}
+			ips = append(ips, h.IPv4)
+		}
+		accepted = append(accepted, ips)
+		fmt.Fprint(w, `{"Status":"Ok","Message":""}`)
+	}))
+	t.Cleanup(s.Close)
+	return s, &accepted
+}
+
+func TestRunResumeSkipsImportedBatches(t *testing.T) {
+	project := lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}, {IPv4: "1.2.3.5"}, {IPv4: "1.2.3.6"}}}
+	filename := filepath.Join(t.TempDir(), "amass.json")
+	results := []string{}
+	for _, h := range project.Hosts {
+		results = append(results, fmt.Sprintf(`{"name":"%s.example.com","addresses":[{"ip":"%s"}]}`, strings.Replace(h.IPv4, ".", "-", -1), h.IPv4))
+	}
+	if err := ioutil.WriteFile(filename, []byte(strings.Join(results, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	opts.batchSize = 1
+	opts.mode = modeFailFast
+	opts.resume = filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// the second batch is refused, which stops a fail-fast run after the first got in
+	s, accepted := rejectingLair(t, project, map[string]bool{"1.2.3.5": true})
+	t.Setenv("LAIR_API_SERVER", withCredentials(s.URL))
+	if err := run(opts, []string{"p1", filename}); err == nil {
+		t.Fatal("expected the refused batch to fail the run")
+	}
+	if want := [][]string{{"1.2.3.4"}}; !reflect.DeepEqual(*accepted, want) {
+		t.Fatalf("lair accepted %v, want %v", *accepted, want)
+	}
+
+	s, accepted = rejectingLair(t, project, nil)
+	t.Setenv("LAIR_API_SERVER", withCredentials(s.URL))
+	if err := run(opts, []string{"p1", filename}); err != nil {
+		t.Fatalf("resume: unexpected error %v", err)
+	}
+	if want := [][]string{{"1.2.3.5"}, {"1.2.3.6"}}; !reflect.DeepEqual(*accepted, want) {
+		t.Errorf("the resumed run sent %v, want only %v", *accepted, want)
+	}
+	if _, err := os.Stat(opts.resume); !os.IsNotExist(err) {
+		t.Errorf("the checkpoint is still there after a complete import: %v", err)
+	}
+}
+
+func TestLoadCheckpointStartsOverOnBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"corrupt":       `{"projectId":"p1",`,
+		"other project": `{"projectId":"p2","input":"abc","hosts":["1.2.3.4"]}`,
+		"other input":   `{"projectId":"p1","input":"def","hosts":["1.2.3.4"]}`,
+	}
+	for name, data := range tests {
+		path := filepath.Join(dir, "checkpoint.json")
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c := loadCheckpoint(path, "p1", "abc")
+		if len(c.Hosts) != 0 || c.ProjectID != "p1" || c.Input != "abc" {
+			t.Errorf("%s: got %+v, want a fresh checkpoint", name, c)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "checkpoint.json"), []byte(`{"projectId":"p1","input":"abc","hosts":["1.2.3.4"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := loadCheckpoint(filepath.Join(dir, "checkpoint.json"), "p1", "abc")
+	rest := c.skip(&lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}, {IPv4: "1.2.3.5"}}})
+	if len(rest.Hosts) != 1 || rest.Hosts[0].IPv4 != "1.2.3.5" {
+		t.Errorf("got %+v, want only the host the checkpoint doesn't have", rest.Hosts)
+	}
+}
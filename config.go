@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// urlFlags hold URLs that may carry credentials, their passwords and queries are redacted by -print-config
+var urlFlags = map[string]bool{"asn-lookup": true, "mirror": true, "proxy": true}
+
+// redactWebhookURL also hides the path of a webhook URL, chat webhooks carry their token in it
+func redactWebhookURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	if u.Path != "" && u.Path != "/" {
+		u.Path = "/xxxxx"
+		u.RawPath = ""
+	}
+	return redactURL(u.String())
+}
+
+// redactFilename redacts the filename argument when it is a URL to download the results from
+func redactFilename(name string) string {
+	if isURL(name) {
+		return redactURL(name)
+	}
+	return name
+}
+
+// printConfig implements -print-config, it shows every setting the tool resolved from the environment,
+// the arguments and the flags, in order of precedence, without ever printing a password or a signed query
+func printConfig(args []string) {
+	fmt.Println("Environment:")
+	lairURL := os.Getenv("LAIR_API_SERVER")
+	if lairURL == "" {
+		fmt.Println("  LAIR_API_SERVER  (not set)")
+	} else {
+		fmt.Printf("  LAIR_API_SERVER  %s\n", redactURL(lairURL))
+	}
+	fmt.Printf("  LAIR_ID          %s\n", valueOrNotSet(os.Getenv("LAIR_ID")))
+	fmt.Println("Arguments:")
+	switch len(args) {
+	case 2:
+		fmt.Printf("  project id       %s (argument, overrides LAIR_ID)\n", args[0])
+		fmt.Printf("  filename         %s\n", redactFilename(args[1]))
+	case 1:
+		fmt.Printf("  project id       %s (LAIR_ID)\n", valueOrNotSet(os.Getenv("LAIR_ID")))
+		fmt.Printf("  filename         %s\n", redactFilename(args[0]))
+	default:
+		fmt.Println("  (missing)")
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	fmt.Println("Flags:")
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if urlFlags[f.Name] && value != "" {
+			redacted := []string{}
+			for _, v := range strings.Split(value, ",") {
+				redacted = append(redacted, redactURL(v))
+			}
+			value = strings.Join(redacted, ",")
+		}
+		if f.Name == "webhook" && value != "" {
+			value = redactWebhookURL(value)
+		}
+		source := "default"
+		if set[f.Name] {
+			source = "set"
+		}
+		fmt.Printf("  -%-22s %s (%s)\n", f.Name, value, source)
+	})
+}
+
+func valueOrNotSet(value string) string {
+	if value == "" {
+		return "(not set)"
+	}
+	return value
+}
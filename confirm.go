@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errNotConfirmed is returned when the -confirm prompt wasn't answered with yes
+var errNotConfirmed = errors.New("not confirmed, nothing was imported")
+
+// isTerminal reports whether f is an interactive terminal rather than a pipe or a file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmImport prints what is about to be imported to out and waits for the user to type yes on in,
+// anything else (including end of input) cancels the import
+func confirmImport(in io.Reader, out io.Writer, summary string) error {
+	fmt.Fprintln(out, summary)
+	fmt.Fprint(out, "Type yes to import: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.TrimSpace(answer) != "yes" {
+		return errNotConfirmed
+	}
+	return nil
+}
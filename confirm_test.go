@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+func TestConfirmImport(t *testing.T) {
+	tests := map[string]bool{
+		"yes\n":   true,
+		" yes \n": true,
+		"yes":     true,
+		"y\n":     false,
+		"YES\n":   false,
+		"no\n":    false,
+		"":        false,
+	}
+	for answer, ok := range tests {
+		var out bytes.Buffer
+		err := confirmImport(strings.NewReader(answer), &out, "About to import 1 hosts")
+		if ok && err != nil {
+			t.Errorf("%q: unexpected error %v", answer, err)
+		}
+		if !ok && !errors.Is(err, errNotConfirmed) {
+			t.Errorf("%q: got %v, want the import cancelled", answer, err)
+		}
+		if !strings.HasPrefix(out.String(), "About to import 1 hosts\n") {
+			t.Errorf("%q: the summary wasn't shown, got %q", answer, out.String())
+		}
+	}
+}
+
+func TestRunConfirmWithoutTerminal(t *testing.T) {
+	// a pipe on stdin is what cron and CI give the drone
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.WriteString("yes\n")
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	project := lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}}}
+	s, imports := lairServer(t, project, "Ok")
+	t.Setenv("LAIR_API_SERVER", withCredentials(s.URL))
+	filename := filepath.Join(t.TempDir(), "amass.json")
+	if err := ioutil.WriteFile(filename, []byte(`{"name":"www.example.com","addresses":[{"ip":"1.2.3.4"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	opts.confirm = true
+	if err := run(opts, []string{"p1", filename}); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Fatalf("got %v, want -confirm refused without a terminal", err)
+	}
+	if len(*imports) != 0 {
+		t.Fatalf("got %d imports without confirmation", len(*imports))
+	}
+	opts.yes = true
+	if err := run(opts, []string{"p1", filename}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(*imports) != 1 {
+		t.Fatalf("got %d imports with -yes, want 1", len(*imports))
+	}
+}
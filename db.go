@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// amassDBRow is a row of the amass (4.x) asset database, from either of its two tables as sqlite3 -json
+// writes them. assets have a type like FQDN or IPAddress and a json content, relations have a type like
+// a_record and the ids of the assets they link
+type amassDBRow struct {
+	ID          dbID            `json:"id"`
+	CreatedAt   string          `json:"created_at"`
+	Type        string          `json:"type"`
+	Content     json.RawMessage `json:"content"`
+	FromAssetID dbID            `json:"from_asset_id"`
+	ToAssetID   dbID            `json:"to_asset_id"`
+}
+
+// amassDBContent is the content of the asset types the drone reads, each only sets its own field:
+// FQDN and RIROrg a name, IPAddress an address, Netblock a cidr and ASN a number
+type amassDBContent struct {
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	CIDR    string    `json:"cidr"`
+	Number  asnNumber `json:"number"`
+}
+
+// dbID is an asset or relation id, sqlite writes them as numbers and postgres exports as strings
+type dbID string
+
+func (id *dbID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*id = ""
+		return nil
+	}
+	*id = dbID(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// amassDBAsset is an asset row with its content decoded, and the input line for -archive-raw
+type amassDBAsset struct {
+	row     amassDBRow
+	content amassDBContent
+	line    string
+}
+
+// dbTimeLayouts are how the asset database writes created_at, sqlite's own format first
+var dbTimeLayouts = []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05", time.RFC3339Nano}
+
+// parse an amass asset database export, json lines of the rows of its assets and relations tables in any
+// order. every FQDN asset becomes a result: its a_record and aaaa_record relations are its addresses, with
+// the cidr of the netblock that contains them, the ASN announcing that netblock and the RIR organization
+// managing the ASN. cname_record targets are kept as CNAMEs and the domain is found by following the node
+// relations from the name up to the root domain. rows refer to each other across the whole file, so
+// nothing is passed to f before every line was read
+func parseDBLines(data []byte, f func(amassResult) bool) error {
+	var bad lineErrors
+	assets := map[dbID]*amassDBAsset{}
+	var fqdns []*amassDBAsset
+	// out and into index the relations by the asset they start from and the one they end at, then by type.
+	// parent is the node relations, from a name to the one it is a subdomain of
+	out := map[dbID]map[string][]dbID{}
+	into := map[dbID]map[string][]dbID{}
+	parent := map[dbID]dbID{}
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var row amassDBRow
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			bad = append(bad, &lineError{line: i + 1, err: err})
+			continue
+		}
+		switch {
+		case row.FromAssetID != "":
+			if out[row.FromAssetID] == nil {
+				out[row.FromAssetID] = map[string][]dbID{}
+			}
+			out[row.FromAssetID][row.Type] = append(out[row.FromAssetID][row.Type], row.ToAssetID)
+			if into[row.ToAssetID] == nil {
+				into[row.ToAssetID] = map[string][]dbID{}
+			}
+			into[row.ToAssetID][row.Type] = append(into[row.ToAssetID][row.Type], row.FromAssetID)
+			if row.Type == "node" {
+				parent[row.ToAssetID] = row.FromAssetID
+			}
+		case len(row.Content) > 0:
+			content, err := decodeDBContent(row.Content)
+			if err != nil {
+				bad = append(bad, &lineError{line: i + 1, err: err})
+				continue
+			}
+			asset := &amassDBAsset{row: row, content: content, line: line}
+			assets[row.ID] = asset
+			if row.Type == "FQDN" {
+				fqdns = append(fqdns, asset)
+			}
+		default:
+			bad = append(bad, &lineError{line: i + 1, err: errors.New("neither an asset nor a relation row")})
+		}
+	}
+	// first returns the first asset of assetType that the relation links id to in edges
+	first := func(edges map[dbID]map[string][]dbID, id dbID, relation, assetType string) *amassDBAsset {
+		for _, to := range edges[id][relation] {
+			if a, ok := assets[to]; ok && a.row.Type == assetType {
+				return a
+			}
+		}
+		return nil
+	}
+	for _, fqdn := range fqdns {
+		result := amassResult{Name: fqdn.content.Name, Domain: fqdn.content.Name, Raw: fqdn.line}
+		seen := map[dbID]bool{}
+		for id := parent[fqdn.row.ID]; id != "" && !seen[id]; id = parent[id] {
+			seen[id] = true
+			if a, ok := assets[id]; ok && a.row.Type == "FQDN" {
+				result.Domain = a.content.Name
+			}
+		}
+		for _, layout := range dbTimeLayouts {
+			if t, err := time.Parse(layout, fqdn.row.CreatedAt); err == nil {
+				result.Timestamp = t.UTC().Format(time.RFC3339)
+				break
+			}
+		}
+		for _, relation := range []string{"a_record", "aaaa_record"} {
+			for _, to := range out[fqdn.row.ID][relation] {
+				ip, ok := assets[to]
+				if !ok || ip.row.Type != "IPAddress" || result.hasAddress(ip.content.Address) {
+					continue
+				}
+				address := amassAddress{IP: ip.content.Address}
+				if netblock := first(into, to, "contains", "Netblock"); netblock != nil {
+					address.Cidr = netblock.content.CIDR
+					if asn := first(into, netblock.row.ID, "announces", "ASN"); asn != nil {
+						address.Asn = asn.content.Number
+						if org := first(out, asn.row.ID, "managed_by", "RIROrg"); org != nil {
+							address.Desc = org.content.Name
+						}
+					}
+				}
+				result.Addresses = append(result.Addresses, address)
+			}
+		}
+		for _, to := range out[fqdn.row.ID]["cname_record"] {
+			if target, ok := assets[to]; ok && target.row.Type == "FQDN" {
+				result.CNAMEs = appendUnique(result.CNAMEs, target.content.Name)
+			}
+		}
+		if !f(result) {
+			break
+		}
+	}
+	return bad.errOrNil()
+}
+
+// decodeDBContent decodes an asset's content, sqlite3 -json writes the json column as a string holding the
+// json while other exports have it as an object
+func decodeDBContent(raw json.RawMessage) (amassDBContent, error) {
+	var content amassDBContent
+	if bytes.HasPrefix(raw, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return content, err
+		}
+		raw = json.RawMessage(s)
+	}
+	err := json.Unmarshal(raw, &content)
+	return content, err
+}
+
+// hasAddress reports whether the result already has the ip
+func (r amassResult) hasAddress(ip string) bool {
+	for _, a := range r.Addresses {
+		if a.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// isDBRecord reports whether a json line looks like a row of the amass asset database rather than enum output
+func isDBRecord(line string) bool {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return false
+	}
+	_, asset := fields["content"]
+	_, relation := fields["from_asset_id"]
+	return asset || relation
+}
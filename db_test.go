@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+func TestParseDBLinesFixture(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/amass_db.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := collect(t, parseDBLines, data)
+	names := []string{}
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	if want := []string{"example.com", "www.example.com", "alias.example.com", "bare.example.com", "ns1.example.net"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got results %v, want %v", names, want)
+	}
+	www := results[1]
+	// the netblock, ASN and organization come from the contains, announces and managed_by relations
+	want := []amassAddress{{IP: "1.2.3.4", Cidr: "1.2.3.0/24", Asn: "13335", Desc: "Example Net"}, {IP: "2001:db8::4"}}
+	if !reflect.DeepEqual(www.Addresses, want) {
+		t.Errorf("www.example.com has addresses %+v, want %+v", www.Addresses, want)
+	}
+	if www.Domain != "example.com" || www.Timestamp != "2024-06-01T12:00:00Z" {
+		t.Errorf("www.example.com has domain %q and timestamp %q", www.Domain, www.Timestamp)
+	}
+	if want := strings.Split(string(data), "\n")[1]; www.Raw != want {
+		t.Errorf("www.example.com has raw line %q, want its asset row", www.Raw)
+	}
+	alias := results[2]
+	if want := []string{"www.example.com"}; !reflect.DeepEqual(alias.CNAMEs, want) {
+		t.Errorf("alias.example.com has CNAMEs %v, want %v", alias.CNAMEs, want)
+	}
+	if alias.Domain != "example.com" || len(alias.Addresses) != 0 {
+		t.Errorf("alias.example.com got %+v", alias)
+	}
+	// a name no node relation leads to is its own domain
+	if ns := results[4]; ns.Domain != "ns1.example.net" {
+		t.Errorf("ns1.example.net has domain %q", ns.Domain)
+	}
+	var bad lineErrors
+	if !errors.As(err, &bad) || len(bad) != 1 {
+		t.Fatalf("got error %v, want the one bad line", err)
+	}
+	var le *lineError
+	if !errors.As(bad[0], &le) || le.line != 9 {
+		t.Errorf("got %v, want line 9 reported", bad[0])
+	}
+}
+
+func TestParseDBLinesAnyRowOrder(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/amass_db.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := collect(t, parseDBLines, data)
+	// relations before the assets they link
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	got, _ := collect(t, parseDBLines, []byte(strings.Join(lines, "\n")))
+	byName := map[string]amassResult{}
+	for _, r := range got {
+		byName[r.Name] = r
+	}
+	for _, r := range want {
+		if !reflect.DeepEqual(byName[r.Name], r) {
+			t.Errorf("%s: got %+v in reverse, want %+v", r.Name, byName[r.Name], r)
+		}
+	}
+}
+
+func TestDetectFormatDB(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/amass_db.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := detectFormat(data); got != "db" {
+		t.Errorf("got %s, want db", got)
+	}
+	if !isDBRecord(`{"id":1,"type":"a_record","from_asset_id":2,"to_asset_id":3}`) || isDBRecord(`{"name":"www.example.com","addresses":[]}`) {
+		t.Error("isDBRecord doesn't tell database rows from enum results")
+	}
+}
+
+func TestRunDBWithParseWorkers(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/amass_db.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if isDBRecord(line) {
+			lines = append(lines, line)
+		}
+	}
+	// split into chunks, the relations would lose the assets they link
+	opts := testOptions()
+	opts.parseWorkers = 4
+	imported := runImport(t, opts, lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}}}, lines...)
+	if len(imported.Hosts) != 1 || !reflect.DeepEqual(imported.Hosts[0].Hostnames, []string{"www.example.com"}) {
+		t.Errorf("got hosts %+v", imported.Hosts)
+	}
+}
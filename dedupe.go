@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// canonicalName is the form of a hostname used to spot near-duplicates: lower case, with the first matching
+// prefix from -strip-www/-strip-prefix removed. it is only ever used for comparing, never stored
+func canonicalName(name string, prefixes []string) string {
+	name = strings.ToLower(name)
+	for _, p := range prefixes {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p != "" && strings.HasPrefix(name, p) && len(name) > len(p) {
+			return strings.TrimPrefix(name, p)
+		}
+	}
+	return name
+}
+
+// resultKey identifies results that describe the same thing: the same canonical name with the same set of
+// addresses, regardless of the order amass listed the addresses in
+func resultKey(r amassResult, prefixes []string) string {
+	addresses := []string{}
+	for _, a := range r.Addresses {
+		addresses = append(addresses, fmt.Sprintf("%s|%s|%s|%s|%d", a.IP, a.Cidr, a.Asn, a.Desc, a.Port))
+	}
+	sort.Strings(addresses)
+	return canonicalName(r.Name, prefixes) + "\n" + strings.Join(addresses, "\n")
+}
+
+// collapse is one duplicate that was folded into its canonical form, for -dedupe-report
+type collapse struct {
+	Kind      string `json:"kind"`
+	Original  string `json:"original"`
+	Canonical string `json:"canonical"`
+	Reason    string `json:"reason"`
+}
+
+// dedupeResults collapses identical results, which amass emits when overlapping sources find the same name,
+// into the first one seen. the sources of the duplicates are merged in and the earliest timestamp is kept.
+// with prefixes, names that only differ by one of them (www.example.com and example.com) count as the same,
+// and the first one seen keeps its original name. it returns the canonical results and what was collapsed into them
+func dedupeResults(results []amassResult, prefixes []string) ([]amassResult, []collapse) {
+	kept := []amassResult{}
+	index := map[string]int{}
+	collapsed := []collapse{}
+	for _, r := range results {
+		key := resultKey(r, prefixes)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(kept)
+			kept = append(kept, r)
+			continue
+		}
+		canonical := &kept[i]
+		reason := "same name and addresses"
+		if r.Name != canonical.Name {
+			reason = "same name ignoring case, and same addresses"
+			if !strings.EqualFold(r.Name, canonical.Name) {
+				reason = "same name once prefixes are stripped, and same addresses"
+			}
+		}
+		collapsed = append(collapsed, collapse{Kind: "result", Original: r.Name, Canonical: canonical.Name, Reason: reason})
+		foldInto(canonical, r)
+	}
+	return kept, collapsed
+}
+
+// foldInto merges the sources of a duplicate into the result it was collapsed into, keeping the earliest timestamp
+func foldInto(canonical *amassResult, r amassResult) {
+	canonical.Sources = appendUnique(canonical.Sources, r.Sources...)
+	canonical.Source = strings.Join(canonical.Sources, ",")
+	if t, ok := r.discovered(); ok {
+		if ct, ok := canonical.discovered(); !ok || t.Before(ct) {
+			canonical.Timestamp = r.Timestamp
+		}
+	}
+}
+
+// ctSources are the amass data sources that read certificate transparency logs, compared in lower case
+var ctSources = map[string]bool{
+	"crtsh": true, "certspotter": true, "censys": true, "facebookct": true, "googlect": true, "entrust": true,
+}
+
+// fromCTOnly reports whether every source of the result reads certificate transparency logs
+func fromCTOnly(r amassResult) bool {
+	if len(r.Sources) == 0 {
+		return false
+	}
+	for _, s := range r.Sources {
+		if !ctSources[strings.ToLower(strings.TrimSpace(s))] {
+			return false
+		}
+	}
+	return true
+}
+
+// ctDedupe collapses the certificate artifacts -ct-dedup targets into the result for the real name. a name
+// only seen in certificate transparency logs is folded into another result for the same name when it has no
+// addresses of its own (the SAN of a precertificate and its leaf, or a name CT found and DNS resolved), and a
+// wildcard SAN like *.foo.example.com is folded into foo.example.com when that was found too. names the CT logs
+// are the only evidence for are kept. it returns the kept results and what was collapsed
+func ctDedupe(results []amassResult) ([]amassResult, []collapse) {
+	key := func(name string) string {
+		return strings.ToLower(strings.TrimSuffix(name, "."))
+	}
+	// the result each name folds into, the first one with addresses wins over ones without
+	targets := map[string]int{}
+	for i, r := range results {
+		if fromCTOnly(r) && (len(r.Addresses) == 0 || strings.HasPrefix(r.Name, "*.")) {
+			continue
+		}
+		j, ok := targets[key(r.Name)]
+		if !ok || (len(results[j].Addresses) == 0 && len(r.Addresses) > 0) {
+			targets[key(r.Name)] = i
+		}
+	}
+	folded := map[int]bool{}
+	collapsed := []collapse{}
+	for i, r := range results {
+		if !fromCTOnly(r) {
+			continue
+		}
+		reason := "only in certificate transparency logs, without addresses"
+		name := key(r.Name)
+		if strings.HasPrefix(name, "*.") {
+			name = strings.TrimPrefix(name, "*.")
+			reason = "wildcard certificate name"
+		} else if len(r.Addresses) > 0 {
+			continue
+		}
+		j, ok := targets[name]
+		if !ok || j == i {
+			continue
+		}
+		folded[i] = true
+		foldInto(&results[j], r)
+		collapsed = append(collapsed, collapse{Kind: "result", Original: r.Name, Canonical: results[j].Name, Reason: reason})
+	}
+	kept := []amassResult{}
+	for i, r := range results {
+		if !folded[i] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, collapsed
+}
+
+// collapseCNAMEs folds the names of a CNAME chain into the last name of the chain the results have, so a chain
+// like www.example.com -> www.example.com.cdn.net -> edge.cdn.net is imported as edge.cdn.net alone when all
+// three were found. the aliases' addresses and sources go with it. the chains come from the cname_record relations
+// of amass db exports, results without CNAMEs are left alone. it returns the kept results and what was collapsed
+func collapseCNAMEs(results []amassResult) ([]amassResult, []collapse) {
+	key := func(name string) string {
+		return strings.ToLower(strings.TrimSuffix(name, "."))
+	}
+	index := map[string]int{}
+	for i, r := range results {
+		if _, ok := index[key(r.Name)]; !ok {
+			index[key(r.Name)] = i
+		}
+	}
+	// terminal follows the chain from result i for as long as the next hop is a result too, a loop stops it
+	terminal := func(i int) (int, int) {
+		hops := 0
+		seen := map[int]bool{i: true}
+		for {
+			next := -1
+			for _, cname := range results[i].CNAMEs {
+				if j, ok := index[key(cname)]; ok && !seen[j] {
+					next = j
+					break
+				}
+			}
+			if next < 0 {
+				return i, hops
+			}
+			seen[next] = true
+			i = next
+			hops++
+		}
+	}
+	folded := map[int]bool{}
+	collapsed := []collapse{}
+	for i, r := range results {
+		// in a loop the first name folded keeps the rest from folding into it
+		j, hops := terminal(i)
+		if j == i || folded[j] {
+			continue
+		}
+		folded[i] = true
+		for _, a := range r.Addresses {
+			known := false
+			for _, b := range results[j].Addresses {
+				if a.IP == b.IP {
+					known = true
+					break
+				}
+			}
+			if !known {
+				results[j].Addresses = append(results[j].Addresses, a)
+			}
+		}
+		foldInto(&results[j], r)
+		collapsed = append(collapsed, collapse{Kind: "result", Original: r.Name, Canonical: results[j].Name, Reason: fmt.Sprintf("CNAME chain, %d from the end", hops)})
+	}
+	kept := []amassResult{}
+	for i, r := range results {
+		if !folded[i] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, collapsed
+}
+
+// sourceRank is where a source falls in the -source-priority list, sources that aren't listed rank last
+func sourceRank(source string, priority []string) int {
+	for i, p := range priority {
+		if strings.EqualFold(source, strings.TrimSpace(p)) {
+			return i
+		}
+	}
+	return len(priority)
+}
+
+// resolveSources records a single source for every hostname: of all the sources that reported the name, the one
+// earliest in priority wins and the rest are dropped. ties between unlisted sources go to the first alphabetically
+// so the provenance is the same no matter what order amass wrote the results in
+func resolveSources(results []amassResult, priority []string) {
+	winners := map[string]string{}
+	for _, r := range results {
+		name := strings.ToLower(r.Name)
+		for _, s := range r.Sources {
+			w, ok := winners[name]
+			if !ok {
+				winners[name] = s
+				continue
+			}
+			sr, wr := sourceRank(s, priority), sourceRank(w, priority)
+			if sr < wr || (sr == wr && s < w) {
+				winners[name] = s
+			}
+		}
+	}
+	for i := range results {
+		if w, ok := winners[strings.ToLower(results[i].Name)]; ok {
+			results[i].Source = w
+			results[i].Sources = []string{w}
+		}
+	}
+}
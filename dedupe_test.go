@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDedupeResults(t *testing.T) {
+	a := amassResult{Name: "www.example.com", Sources: []string{"DNS"}, Addresses: []amassAddress{{IP: "1.2.3.4"}, {IP: "1.2.3.5"}}}
+	// the same addresses in another order, from another source
+	b := amassResult{Name: "www.example.com", Sources: []string{"Crtsh"}, Addresses: []amassAddress{{IP: "1.2.3.5"}, {IP: "1.2.3.4"}}}
+	// a different address set is a different result
+	c := amassResult{Name: "www.example.com", Sources: []string{"DNS"}, Addresses: []amassAddress{{IP: "1.2.3.4"}}}
+	d := amassResult{Name: "example.com", Sources: []string{"DNS"}, Addresses: []amassAddress{{IP: "1.2.3.4"}}}
+	kept, collapsed := dedupeResults([]amassResult{a, b, c}, nil)
+	if len(kept) != 2 || len(collapsed) != 1 {
+		t.Fatalf("kept %d and collapsed %d, want 2 and 1", len(kept), len(collapsed))
+	}
+	if !reflect.DeepEqual(kept[0].Sources, []string{"DNS", "Crtsh"}) {
+		t.Errorf("the duplicate's sources weren't merged: %v", kept[0].Sources)
+	}
+	kept, collapsed = dedupeResults([]amassResult{c, d}, []string{"www."})
+	if len(kept) != 1 || kept[0].Name != "www.example.com" {
+		t.Errorf("got %+v, want www.example.com to stand for both", kept)
+	}
+	if len(collapsed) != 1 || collapsed[0].Reason != "same name once prefixes are stripped, and same addresses" {
+		t.Errorf("got %+v", collapsed)
+	}
+}
+
+// benchResults are n distinct results with a few addresses each, like a large amass enum
+func benchResults(n int) []amassResult {
+	results := make([]amassResult, n)
+	for i := range results {
+		results[i] = amassResult{
+			Name:    fmt.Sprintf("host%d.example.com", i),
+			Sources: []string{"DNS"},
+			Addresses: []amassAddress{
+				{IP: fmt.Sprintf("10.%d.%d.1", i/256%256, i%256), Cidr: "10.0.0.0/8", Asn: "64512", Desc: "net"},
+				{IP: fmt.Sprintf("10.%d.%d.2", i/256%256, i%256), Cidr: "10.0.0.0/8", Asn: "64512", Desc: "net"},
+			},
+		}
+	}
+	return results
+}
+
+// BenchmarkDedupeResults is the scan -skip-dedupe leaves out
+func BenchmarkDedupeResults(b *testing.B) {
+	results := benchResults(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dedupeResults(results, nil)
+	}
+}
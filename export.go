@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// connectLair makes the lair client for the modes that run without amass results (-restore, -export-only)
+// from LAIR_API_SERVER and the connection flags, the same way run does
+func connectLair(opts options) (lairAPI, error) {
+	lairURL := os.Getenv("LAIR_API_SERVER")
+	if lairURL == "" {
+		return nil, errors.New("setup: missing LAIR_API_SERVER environment variable")
+	}
+	var cert *tls.Certificate
+	if opts.clientCert != "" || opts.clientKey != "" {
+		var err error
+		if cert, err = loadClientCert(opts.clientCert, opts.clientKey); err != nil {
+			return nil, fmt.Errorf("setup: %w", err)
+		}
+	}
+	lairClient, err := newLairClient(lairURL, opts.insecureSSL, cert, opts.requestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("setup: LAIR_API_SERVER: %w", err)
+	}
+	return withRetries(lairClient, opts.requestTimeout, opts.requestRetries), nil
+}
+
+// exportOnly implements -export-only, it exports the project and prints it as indented json, or writes it to
+// -export-file, to look at what lair has before or after a run. nothing is parsed or imported
+func exportOnly(opts options, args []string) error {
+	lairPID := os.Getenv("LAIR_ID")
+	if len(args) > 0 {
+		lairPID = args[0]
+	}
+	if lairPID == "" {
+		return errors.New("setup: missing LAIR_ID")
+	}
+	lairClient, err := connectLair(opts)
+	if err != nil {
+		return err
+	}
+	project, err := lairClient.ExportProject(lairPID)
+	if err != nil {
+		return fmt.Errorf("export: unable to export project %s: %w", lairPID, err)
+	}
+	if opts.exportFile == "" {
+		return printJSON(project)
+	}
+	data, err := json.MarshalIndent(project, "", "  ")
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	// like a backup, the export is everything lair knows about the project
+	if err := ioutil.WriteFile(opts.exportFile, data, 0600); err != nil {
+		return fmt.Errorf("export: could not write %s: %w", opts.exportFile, err)
+	}
+	log.Printf("Info: Exported project %s with %d hosts and %d netblocks to %s", lairPID, len(project.Hosts), len(project.Netblocks), opts.exportFile)
+	return nil
+}
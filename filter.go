@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// hasDomainSuffix reports whether name is suffix or a subdomain of it, so "akamaiedge.net" matches
+// "a.akamaiedge.net" but not "notakamaiedge.net". a leading "*." or "." on the suffix is ignored
+func hasDomainSuffix(name, suffix string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	suffix = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(suffix), "*"), "."))
+	if suffix == "" {
+		return false
+	}
+	return name == suffix || strings.HasSuffix(name, "."+suffix)
+}
+
+// dropSuffixes removes the results whose name falls under any of the suffixes
+func dropSuffixes(results []amassResult, suffixes []string) []amassResult {
+	kept := []amassResult{}
+	for _, r := range results {
+		drop := false
+		for _, suffix := range suffixes {
+			if hasDomainSuffix(r.Name, suffix) {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// parseExcludedIPs reads the -exclude-ip list into canonical form, so 2001:db8::1 and 2001:DB8:0::1 are the same IP
+func parseExcludedIPs(list string) (map[string]bool, error) {
+	ips := map[string]bool{}
+	for _, s := range strings.Split(list, ",") {
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address", strings.TrimSpace(s))
+		}
+		ips[ip.String()] = true
+	}
+	return ips, nil
+}
+
+// dropResolvedTo removes the results that resolve to any of the excluded IPs, a sinkhole or a parking page
+// shared by many names. the whole result goes, not just the address. it returns the kept results and how many
+// results each excluded IP dropped
+func dropResolvedTo(results []amassResult, excluded map[string]bool) ([]amassResult, map[string]int) {
+	kept := []amassResult{}
+	dropped := map[string]int{}
+	for _, r := range results {
+		hit := ""
+		for _, a := range r.Addresses {
+			if ip := net.ParseIP(a.IP); ip != nil && excluded[ip.String()] {
+				hit = ip.String()
+				break
+			}
+		}
+		if hit != "" {
+			dropped[hit]++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept, dropped
+}
+
+// isPrivateIP reports whether ip is in a private or otherwise reserved range that never belongs
+// on an external engagement: RFC1918 and unique local, loopback, link local, multicast and unspecified
+func isPrivateIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() ||
+		parsed.IsLinkLocalMulticast() || parsed.IsInterfaceLocalMulticast() || parsed.IsMulticast() ||
+		parsed.IsUnspecified()
+}
+
+// dropPrivateIPs removes private addresses from the results, results left without any address are dropped.
+// it returns the kept results and how many addresses were skipped
+func dropPrivateIPs(results []amassResult) ([]amassResult, int) {
+	return dropAddresses(results, func(a amassAddress) bool { return isPrivateIP(a.IP) })
+}
+
+// address families for -address-family
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+	familyBoth = "both"
+)
+
+// dropAddressFamily removes the addresses that aren't in family, results left without any address are dropped.
+// addresses whose IP doesn't parse are kept, they can't be told apart. it returns the kept results and how many
+// addresses were skipped
+func dropAddressFamily(results []amassResult, family string) ([]amassResult, int) {
+	if family == familyBoth {
+		return results, 0
+	}
+	return dropAddresses(results, func(a amassAddress) bool {
+		ip := net.ParseIP(a.IP)
+		if ip == nil {
+			return false
+		}
+		return (ip.To4() != nil) != (family == familyIPv4)
+	})
+}
+
+// dropAddresses removes the addresses drop returns true for, results left without any address are dropped
+// but results that never had one are kept. it returns the kept results and how many addresses were removed
+func dropAddresses(results []amassResult, drop func(amassAddress) bool) ([]amassResult, int) {
+	kept := []amassResult{}
+	skipped := 0
+	for _, r := range results {
+		if len(r.Addresses) == 0 {
+			kept = append(kept, r)
+			continue
+		}
+		addresses := []amassAddress{}
+		for _, a := range r.Addresses {
+			if drop(a) {
+				skipped++
+				continue
+			}
+			addresses = append(addresses, a)
+		}
+		if len(addresses) == 0 {
+			continue
+		}
+		r.Addresses = addresses
+		kept = append(kept, r)
+	}
+	return kept, skipped
+}
+
+// subdomainPart is the part of name in front of domain, "a.b" for "a.b.example.com" in example.com. without a
+// domain, or when name isn't under it, the first label is used. the apex itself has no subdomain part
+func subdomainPart(name, domain string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain != "" && name == domain {
+		return ""
+	}
+	if domain != "" && strings.HasSuffix(name, "."+domain) {
+		return strings.TrimSuffix(name, "."+domain)
+	}
+	return strings.SplitN(name, ".", 2)[0]
+}
+
+// dropShortNames removes the results whose subdomain part is shorter than min characters, the one letter
+// names aggressive brute forcing turns up are rarely real. the apex of a domain is always kept
+func dropShortNames(results []amassResult, min int) []amassResult {
+	kept := []amassResult{}
+	for _, r := range results {
+		if sub := subdomainPart(r.Name, r.Domain); sub != "" && len(sub) < min {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// filterHostnames keeps the results whose name matches include (if given) and doesn't match exclude.
+// exclude always wins over include
+func filterHostnames(results []amassResult, include, exclude *regexp.Regexp) []amassResult {
+	kept := []amassResult{}
+	for _, r := range results {
+		if exclude != nil && exclude.MatchString(r.Name) {
+			continue
+		}
+		if include != nil && !include.MatchString(r.Name) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// capAddresses trims results that list more than max addresses down to the first max, so a single
+// pathological record can't blow up the matching loops. it returns the names of the trimmed results
+func capAddresses(results []amassResult, max int) []string {
+	capped := []string{}
+	for i := range results {
+		if len(results[i].Addresses) > max {
+			capped = append(capped, results[i].Name)
+			results[i].Addresses = results[i].Addresses[:max]
+		}
+	}
+	return capped
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lair-framework/api-server/client"
+	"github.com/lair-framework/go-lair"
+)
+
+// importer sends projects to the lair API server, waiting -import-delay between consecutive calls
+// so the server gets some breathing room when an import is split into several requests
+type importer struct {
+	client  lairAPI
+	options *client.DOptions
+	delay   time.Duration
+	calls   int
+	// deadline is when -max-runtime runs out, no further batches are started after it
+	deadline time.Time
+	// order is the -import-order
+	order string
+	// failFast turns off retrying rejected batches one record at a time
+	failFast bool
+	// split sends hosts and netblocks as separate imports, for -split-import
+	split bool
+	// checkpoint records what lair accepted, for -resume
+	checkpoint *checkpoint
+	// warnings are what lair warned about in its responses, for -fail-on-api-warnings
+	warnings []string
+}
+
+// droneResponse is the drone response from lair. servers with data protection can add warnings to an import
+// they accepted, e.g. about ports they dropped, the client's Response doesn't have them
+type droneResponse struct {
+	client.Response
+	Warnings []string `json:"warnings"`
+}
+
+// rejectedError means lair answered but refused the data, as opposed to not being reachable at all
+type rejectedError struct {
+	message string
+}
+
+func (e *rejectedError) Error() string {
+	return "import failed: " + e.message
+}
+
+// importProject sends a single project to lair and checks the drone response
+func (i *importer) importProject(project *lair.Project) error {
+	if i.calls > 0 && i.delay > 0 {
+		time.Sleep(i.delay)
+	}
+	i.calls++
+	res, err := i.client.ImportProject(i.options, project)
+	if err != nil {
+		return fmt.Errorf("unable to import project: %w", err)
+	}
+	defer res.Body.Close()
+	droneRes := &droneResponse{}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response: %w", err)
+	}
+	if err := json.Unmarshal(body, droneRes); err != nil {
+		return fmt.Errorf("could not unmarshal JSON: %w", err)
+	}
+	if droneRes.Status == "Error" {
+		return &rejectedError{message: droneRes.Message}
+	}
+	for _, w := range droneRes.Warnings {
+		warnf("Lair warned about the import: %s", w)
+		i.warnings = append(i.warnings, w)
+	}
+	return nil
+}
+
+// importBatches sends the project in batches of at most size hosts, a size of 0 sends everything at once
+func (i *importer) importBatches(project *lair.Project, size int) error {
+	batches := splitBatches(project, size, i.order)
+	failed := []string{}
+	for n, batch := range batches {
+		// the batch would only start after the delay, so that is what counts against the deadline
+		if n > 0 && !i.deadline.IsZero() && time.Now().Add(i.delay).After(i.deadline) {
+			return &partialError{reason: fmt.Sprintf("max runtime reached after importing %d of %d batches", n, len(batches))}
+		}
+		if err := i.importProject(batch); err != nil {
+			// one bad record makes lair reject the whole batch, so find it instead of giving up on the rest
+			var rejected *rejectedError
+			if !i.failFast && errors.As(err, &rejected) && len(batch.Hosts)+len(batch.Netblocks) > 1 {
+				warnf("Import of batch %d of %d was rejected (%s), retrying its records one at a time", n+1, len(batches), rejected.message)
+				failed = append(failed, i.retryRecords(batch)...)
+				continue
+			}
+			if len(batches) > 1 {
+				return fmt.Errorf("batch %d of %d: %w", n+1, len(batches), err)
+			}
+			return err
+		}
+		i.accepted(batch)
+	}
+	if len(failed) > 0 {
+		for _, f := range failed {
+			warnf("Could not import %s", f)
+		}
+		return &partialError{reason: fmt.Sprintf("%d records could not be imported", len(failed))}
+	}
+	return nil
+}
+
+// accepted notes in the -resume checkpoint that lair took the batch. a checkpoint that can't be saved only
+// costs a longer resume, so it doesn't stop the import
+func (i *importer) accepted(batch *lair.Project) {
+	if i.checkpoint == nil {
+		return
+	}
+	if err := i.checkpoint.record(batch); err != nil {
+		warnf("Could not update checkpoint %s. Error %s", i.checkpoint.path, err.Error())
+	}
+}
+
+// send imports the project the way the importer was set up to, split by type or in batches
+func (i *importer) send(project *lair.Project, size int) error {
+	if i.split {
+		return i.importSplit(project, size)
+	}
+	return i.importBatches(project, size)
+}
+
+// importSplit sends the hosts and the netblocks as separate imports, in -import-order, so a failure in one
+// doesn't keep the other out of lair. both are always attempted and reported on their own, if only one of
+// them failed the result is a partial import
+func (i *importer) importSplit(project *lair.Project, size int) error {
+	type part struct {
+		name    string
+		count   int
+		project *lair.Project
+	}
+	parts := []part{
+		{"hosts", len(project.Hosts), &lair.Project{ID: project.ID, Tool: project.Tool, Commands: project.Commands, Hosts: project.Hosts}},
+		{"netblocks", len(project.Netblocks), &lair.Project{ID: project.ID, Tool: project.Tool, Commands: project.Commands, Netblocks: project.Netblocks}},
+	}
+	if i.order == orderNetblocksFirst {
+		parts[0], parts[1] = parts[1], parts[0]
+	}
+	failed := []string{}
+	landed := false
+	for _, p := range parts {
+		if p.count == 0 {
+			continue
+		}
+		if err := i.importBatches(p.project, size); err != nil {
+			// a partial import of one part still got some records into lair
+			var partial *partialError
+			if errors.As(err, &partial) {
+				landed = true
+			}
+			warnf("Import of %d %s failed. Error %s", p.count, p.name, err.Error())
+			failed = append(failed, p.name)
+			continue
+		}
+		landed = true
+		log.Printf("Info: Imported %d %s", p.count, p.name)
+	}
+	switch {
+	case len(failed) == 0:
+		return nil
+	case landed:
+		return &partialError{reason: fmt.Sprintf("the %s import failed", strings.Join(failed, " and "))}
+	}
+	return errors.New("both the hosts and the netblocks imports failed")
+}
+
+// retryRecords sends a rejected batch again one netblock and one host at a time, so a single malformed
+// record doesn't keep the rest of the batch out of lair. it returns the records that were still refused
+func (i *importer) retryRecords(batch *lair.Project) []string {
+	failed := []string{}
+	for _, n := range batch.Netblocks {
+		single := &lair.Project{ID: batch.ID, Tool: batch.Tool, Commands: batch.Commands, Netblocks: []lair.Netblock{n}}
+		if err := i.importProject(single); err != nil {
+			failed = append(failed, fmt.Sprintf("netblock %s: %s", n.CIDR, err))
+			continue
+		}
+		i.accepted(single)
+	}
+	for _, h := range batch.Hosts {
+		single := &lair.Project{ID: batch.ID, Tool: batch.Tool, Commands: batch.Commands, Hosts: []lair.Host{h}}
+		if err := i.importProject(single); err != nil {
+			failed = append(failed, fmt.Sprintf("host %s: %s", h.IPv4, err))
+			continue
+		}
+		i.accepted(single)
+	}
+	return failed
+}
+
+// the -import-order values. together sends the netblocks along with the first batch of hosts, the others
+// send the netblocks on their own, before or after all of the hosts
+const (
+	orderTogether       = "together"
+	orderHostsFirst     = "hosts-first"
+	orderNetblocksFirst = "netblocks-first"
+)
+
+// splitBatches breaks a project up into several projects with at most size hosts each, and places
+// the netblocks according to order
+func splitBatches(project *lair.Project, size int, order string) []*lair.Project {
+	if order == orderTogether && (size <= 0 || len(project.Hosts) <= size) {
+		return []*lair.Project{project}
+	}
+	if size <= 0 {
+		size = len(project.Hosts)
+	}
+	batches := []*lair.Project{}
+	for start := 0; start < len(project.Hosts); start += size {
+		end := start + size
+		if end > len(project.Hosts) {
+			end = len(project.Hosts)
+		}
+		batch := &lair.Project{
+			ID:       project.ID,
+			Tool:     project.Tool,
+			Commands: project.Commands,
+			Hosts:    project.Hosts[start:end],
+		}
+		if start == 0 && order == orderTogether {
+			batch.Netblocks = project.Netblocks
+		}
+		batches = append(batches, batch)
+	}
+	if order == orderTogether || len(project.Netblocks) == 0 {
+		return batches
+	}
+	netblocks := &lair.Project{
+		ID:        project.ID,
+		Tool:      project.Tool,
+		Commands:  project.Commands,
+		Netblocks: project.Netblocks,
+	}
+	if order == orderNetblocksFirst {
+		return append([]*lair.Project{netblocks}, batches...)
+	}
+	return append(batches, netblocks)
+}
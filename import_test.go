@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/api-server/client"
+	"github.com/lair-framework/go-lair"
+)
+
+// fakeLair is a lairAPI that keeps every import it was sent and rejects any import carrying one of
+// the reject IPs or CIDRs, like lair does for a malformed record
+type fakeLair struct {
+	reject  map[string]bool
+	imports []*lair.Project
+}
+
+func (f *fakeLair) ExportProject(id string) (lair.Project, error) {
+	return lair.Project{ID: id}, nil
+}
+
+func (f *fakeLair) ImportProject(o *client.DOptions, p *lair.Project) (*http.Response, error) {
+	f.imports = append(f.imports, p)
+	body := `{"Status":"Ok","Message":""}`
+	for _, h := range p.Hosts {
+		if f.reject[h.IPv4] {
+			body = fmt.Sprintf(`{"Status":"Error","Message":"bad host %s"}`, h.IPv4)
+		}
+	}
+	for _, n := range p.Netblocks {
+		if f.reject[n.CIDR] {
+			body = fmt.Sprintf(`{"Status":"Error","Message":"bad netblock %s"}`, n.CIDR)
+		}
+	}
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+}
+
+// accepted is every host IP and netblock CIDR that made it into lair
+func (f *fakeLair) accepted() []string {
+	got := []string{}
+	for _, p := range f.imports {
+		if f.rejects(p) {
+			continue
+		}
+		for _, n := range p.Netblocks {
+			got = append(got, n.CIDR)
+		}
+		for _, h := range p.Hosts {
+			got = append(got, h.IPv4)
+		}
+	}
+	return got
+}
+
+func (f *fakeLair) rejects(p *lair.Project) bool {
+	for _, h := range p.Hosts {
+		if f.reject[h.IPv4] {
+			return true
+		}
+	}
+	for _, n := range p.Netblocks {
+		if f.reject[n.CIDR] {
+			return true
+		}
+	}
+	return false
+}
+
+// testProject has hosts 10.0.0.1 to 10.0.0.hosts and netblocks 10.n.0.0/16
+func testProject(hosts, netblocks int) *lair.Project {
+	p := &lair.Project{ID: "p1", Tool: "amass"}
+	for i := 1; i <= hosts; i++ {
+		p.Hosts = append(p.Hosts, lair.Host{IPv4: fmt.Sprintf("10.0.0.%d", i)})
+	}
+	for i := 1; i <= netblocks; i++ {
+		p.Netblocks = append(p.Netblocks, lair.Netblock{CIDR: fmt.Sprintf("10.%d.0.0/16", i)})
+	}
+	return p
+}
+
+func TestImportBatchesRetriesRejectedBatchRecordByRecord(t *testing.T) {
+	api := &fakeLair{reject: map[string]bool{"10.0.0.3": true}}
+	i := &importer{client: api, options: &client.DOptions{}, order: orderTogether}
+	err := i.importBatches(testProject(5, 1), 2)
+	var partial *partialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("got %v, want a partial import", err)
+	}
+	if partial.reason != "1 records could not be imported" {
+		t.Errorf("got reason %q", partial.reason)
+	}
+	// three batches, and the rejected second one again as two single hosts
+	if len(api.imports) != 5 {
+		t.Errorf("got %d imports, want 5", len(api.imports))
+	}
+	want := []string{"10.1.0.0/16", "10.0.0.1", "10.0.0.2", "10.0.0.4", "10.0.0.5"}
+	if got := api.accepted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lair got %v, want %v", got, want)
+	}
+}
+
+func TestImportBatchesRetriesRejectedNetblock(t *testing.T) {
+	api := &fakeLair{reject: map[string]bool{"10.2.0.0/16": true}}
+	i := &importer{client: api, options: &client.DOptions{}, order: orderTogether}
+	var partial *partialError
+	if err := i.importBatches(testProject(2, 2), 0); !errors.As(err, &partial) {
+		t.Fatalf("got %v, want a partial import", err)
+	}
+	want := []string{"10.1.0.0/16", "10.0.0.1", "10.0.0.2"}
+	if got := api.accepted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("lair got %v, want %v", got, want)
+	}
+}
+
+func TestImportBatchesFailFastDoesNotRetry(t *testing.T) {
+	api := &fakeLair{reject: map[string]bool{"10.0.0.3": true}}
+	i := &importer{client: api, options: &client.DOptions{}, order: orderTogether, failFast: true}
+	err := i.importBatches(testProject(5, 0), 2)
+	var rejected *rejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("got %v, want the rejection", err)
+	}
+	if !strings.HasPrefix(err.Error(), "batch 2 of 3: ") {
+		t.Errorf("got %q, want it to name the batch", err)
+	}
+	if len(api.imports) != 2 {
+		t.Errorf("got %d imports, want 2", len(api.imports))
+	}
+}
+
+func TestImportBatchesSingleRecordIsNotRetried(t *testing.T) {
+	api := &fakeLair{reject: map[string]bool{"10.0.0.1": true}}
+	i := &importer{client: api, options: &client.DOptions{}, order: orderTogether}
+	var rejected *rejectedError
+	if err := i.importBatches(testProject(1, 0), 0); !errors.As(err, &rejected) {
+		t.Fatalf("got %v, want the rejection", err)
+	}
+	if len(api.imports) != 1 {
+		t.Errorf("got %d imports, want 1", len(api.imports))
+	}
+}
+
+// batchShape describes each batch as its host count and netblock count, e.g. "2h1n"
+func batchShape(batches []*lair.Project) []string {
+	shape := []string{}
+	for _, b := range batches {
+		shape = append(shape, fmt.Sprintf("%dh%dn", len(b.Hosts), len(b.Netblocks)))
+	}
+	return shape
+}
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		hosts, netblocks, size int
+		order                  string
+		want                   []string
+	}{
+		{5, 2, 0, orderTogether, []string{"5h2n"}},
+		{5, 2, 10, orderTogether, []string{"5h2n"}},
+		{5, 2, 2, orderTogether, []string{"2h2n", "2h0n", "1h0n"}},
+		{5, 2, 2, orderHostsFirst, []string{"2h0n", "2h0n", "1h0n", "0h2n"}},
+		{5, 2, 2, orderNetblocksFirst, []string{"0h2n", "2h0n", "2h0n", "1h0n"}},
+		{5, 2, 0, orderHostsFirst, []string{"5h0n", "0h2n"}},
+		{5, 0, 0, orderNetblocksFirst, []string{"5h0n"}},
+		{0, 2, 0, orderNetblocksFirst, []string{"0h2n"}},
+	}
+	for _, tt := range tests {
+		got := batchShape(splitBatches(testProject(tt.hosts, tt.netblocks), tt.size, tt.order))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d hosts, %d netblocks, size %d, %s: got %v, want %v", tt.hosts, tt.netblocks, tt.size, tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestSplitBatchesKeepsEveryHostOnce(t *testing.T) {
+	project := testProject(7, 0)
+	seen := map[string]int{}
+	for _, b := range splitBatches(project, 3, orderTogether) {
+		if b.ID != project.ID || b.Tool != project.Tool {
+			t.Errorf("batch lost the project id or tool: %q %q", b.ID, b.Tool)
+		}
+		for _, h := range b.Hosts {
+			seen[h.IPv4]++
+		}
+	}
+	for _, h := range project.Hosts {
+		if seen[h.IPv4] != 1 {
+			t.Errorf("%s is in %d batches", h.IPv4, seen[h.IPv4])
+		}
+	}
+}
+
+func TestImportSplitSendsHostsAndNetblocksApart(t *testing.T) {
+	api := &fakeLair{}
+	i := &importer{client: api, options: &client.DOptions{}, order: orderNetblocksFirst, split: true}
+	if err := i.send(testProject(2, 1), 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := batchShape(api.imports); !reflect.DeepEqual(got, []string{"0h1n", "2h0n"}) {
+		t.Errorf("got imports %v, want the netblocks first then the hosts", got)
+	}
+}
+
+func TestImportSplitOneFailedPartIsPartial(t *testing.T) {
+	api := &fakeLair{reject: map[string]bool{"10.1.0.0/16": true}}
+	i := &importer{client: api, options: &client.DOptions{}, order: orderTogether, split: true}
+	err := i.importSplit(testProject(2, 1), 0)
+	var partial *partialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("got %v, want a partial import", err)
+	}
+	if partial.reason != "the netblocks import failed" {
+		t.Errorf("got reason %q", partial.reason)
+	}
+	if got := api.accepted(); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("lair got %v, want only the hosts", got)
+	}
+}
+
+func TestImportSplitBothFailed(t *testing.T) {
+	api := &fakeLair{reject: map[string]bool{"10.0.0.1": true, "10.1.0.0/16": true}}
+	i := &importer{client: api, options: &client.DOptions{}, order: orderTogether, split: true}
+	err := i.importSplit(testProject(1, 1), 0)
+	var partial *partialError
+	if err == nil || errors.As(err, &partial) {
+		t.Fatalf("got %v, want a failed import", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// fetchOptions control how results are downloaded when the filename argument is a URL
+type fetchOptions struct {
+	insecure bool
+	timeout  time.Duration
+	proxy    string
+	// encoding is the -input-encoding the data is transcoded from
+	encoding string
+}
+
+// isURL reports whether the filename argument should be fetched over http(s) instead of read from disk
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// readInput reads the amass results from a local file or a URL, decompressing gzip data if needed
+// and converting it to utf-8
+func readInput(name string, opts fetchOptions) ([]byte, error) {
+	var data []byte
+	var err error
+	if isURL(name) {
+		data, err = fetchInput(name, opts)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = gunzip(data); err != nil {
+		return nil, err
+	}
+	return decodeInput(data, opts.encoding)
+}
+
+// fetchInput downloads the results file, e.g. from a presigned object storage URL
+func fetchInput(rawURL string, opts fetchOptions) ([]byte, error) {
+	tr := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.insecure},
+	}
+	if opts.proxy != "" {
+		p, err := url.Parse(opts.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		tr.Proxy = http.ProxyURL(p)
+	}
+	client := &http.Client{Transport: tr, Timeout: opts.timeout}
+	res, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// gunzip returns data decompressed if it starts with the gzip magic bytes, otherwise it is returned unchanged
+func gunzip(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// utf8BOM is the byte order mark some windows tools and wrappers put in front of utf-8 files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// inputEncodings are the -input-encoding values that need transcoding, utf-8 is used as is
+var inputEncodings = map[string]encoding.Encoding{
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"latin1":       charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+}
+
+// decodeInput transcodes data from the named encoding to utf-8 and strips a leading utf-8 BOM,
+// which json decoding chokes on with a cryptic "invalid character" error
+func decodeInput(data []byte, name string) ([]byte, error) {
+	if name != "" && name != "utf-8" {
+		enc, ok := inputEncodings[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown input encoding %s", name)
+		}
+		decoded, err := enc.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode %s input: %w", name, err)
+		}
+		data = decoded
+	}
+	return bytes.TrimPrefix(data, utf8BOM), nil
+}
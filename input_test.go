@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const inputLine = `{"name":"www.example.com","domain":"example.com","addresses":[{"ip":"1.2.3.4"}]}` + "\n"
+
+// serveInput serves body at /results.json and 404s everything else
+func serveInput(body []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/results.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	})
+}
+
+func TestReadInputFromURL(t *testing.T) {
+	s := httptest.NewServer(serveInput(append(utf8BOM, inputLine...)))
+	defer s.Close()
+	data, err := readInput(s.URL+"/results.json?X-Amz-Signature=abc", fetchOptions{timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if string(data) != inputLine {
+		t.Errorf("got %q, want %q", data, inputLine)
+	}
+}
+
+func TestReadInputFromURLGzip(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(inputLine))
+	w.Close()
+	s := httptest.NewServer(serveInput(gz.Bytes()))
+	defer s.Close()
+	data, err := readInput(s.URL+"/results.json", fetchOptions{timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if string(data) != inputLine {
+		t.Errorf("got %q, want %q", data, inputLine)
+	}
+}
+
+func TestReadInputFromURLNotFound(t *testing.T) {
+	s := httptest.NewServer(serveInput(nil))
+	defer s.Close()
+	if _, err := readInput(s.URL+"/missing.json", fetchOptions{timeout: 5 * time.Second}); err == nil {
+		t.Fatal("expected an error for a 404")
+	}
+}
+
+func TestReadInputFromURLTimeout(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer s.Close()
+	defer close(release)
+	if _, err := readInput(s.URL+"/results.json", fetchOptions{timeout: 100 * time.Millisecond}); err == nil {
+		t.Fatal("expected a timeout")
+	}
+}
+
+func TestReadInputFromURLTLS(t *testing.T) {
+	s := httptest.NewTLSServer(serveInput([]byte(inputLine)))
+	defer s.Close()
+	// the test server's certificate isn't trusted, so only -k gets through
+	if _, err := readInput(s.URL+"/results.json", fetchOptions{timeout: 5 * time.Second}); err == nil {
+		t.Fatal("expected a certificate error without -k")
+	}
+	data, err := readInput(s.URL+"/results.json", fetchOptions{timeout: 5 * time.Second, insecure: true})
+	if err != nil {
+		t.Fatalf("unexpected error with -k %v", err)
+	}
+	if string(data) != inputLine {
+		t.Errorf("got %q, want %q", data, inputLine)
+	}
+}
+
+func TestReadInputFromURLProxy(t *testing.T) {
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte(inputLine))
+	}))
+	defer proxy.Close()
+	// nothing listens on the target, the proxy answers for it
+	target := "http://results.invalid/results.json"
+	if _, err := readInput(target, fetchOptions{timeout: 5 * time.Second, proxy: proxy.URL}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if proxied != target {
+		t.Errorf("the proxy got %q, want %q", proxied, target)
+	}
+	if _, err := readInput(target, fetchOptions{proxy: "http://%zz"}); err == nil {
+		t.Error("expected an error for a broken proxy URL")
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	for name, want := range map[string]bool{
+		"https://bucket.example.com/o.json": true,
+		"http://10.0.0.1/o.json":            true,
+		"results.json":                      false,
+		"ftp://example.com/o.json":          false,
+	} {
+		if got := isURL(name); got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"text/template"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// defaultLinkTemplate is where the lair UI shows a host, -lair-url-template changes it for other deployments
+const defaultLinkTemplate = "{{.Server}}/project/{{.ProjectID}}/hosts/{{.HostID}}"
+
+// linkData is what a -lair-url-template can use
+type linkData struct {
+	Server    string
+	ProjectID string
+	HostID    string
+	IP        string
+}
+
+// linkServer is the scheme and host of the lair API server URL, without credentials, path or trailing slash
+func linkServer(lairURL string) (string, error) {
+	u, err := url.Parse(lairURL)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String(), nil
+}
+
+// repeatedSlashes are the doubled slashes a template can produce, e.g. from a server given with a trailing slash
+var repeatedSlashes = regexp.MustCompile(`/{2,}`)
+
+// hostLink renders the link to one host. slashes doubled up in the path are collapsed, so templates don't have
+// to care whether the server ends in a slash
+func hostLink(t *template.Template, data linkData) (string, error) {
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(out.String())
+	if err != nil {
+		return "", err
+	}
+	u.Path = repeatedSlashes.ReplaceAllString(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// printHostLinks is the -output-lair-url output, a link for each of the hosts with the given IPs, in IP order with IPv4 first.
+// hosts is the project as lair has it after the import, so new hosts have their id. it returns how many links it printed
+func printHostLinks(t *template.Template, server, projectID string, hosts []lair.Host, ips map[string]bool) (int, error) {
+	sorted := append([]lair.Host{}, hosts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := net.ParseIP(sorted[i].IPv4), net.ParseIP(sorted[j].IPv4)
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+		if a == nil || a.Equal(b) {
+			return sorted[i].IPv4 < sorted[j].IPv4
+		}
+		return ipLess(a, b)
+	})
+	printed := 0
+	for _, h := range sorted {
+		if !ips[h.IPv4] {
+			continue
+		}
+		link, err := hostLink(t, linkData{Server: server, ProjectID: projectID, HostID: h.ID, IP: h.IPv4})
+		if err != nil {
+			return printed, fmt.Errorf("host %s: %w", h.IPv4, err)
+		}
+		fmt.Printf("%s %s\n", h.IPv4, link)
+		printed++
+	}
+	return printed, nil
+}
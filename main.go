@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
-	"strconv"
+	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/lair-framework/api-server/client"
 	"github.com/lair-framework/go-lair"
@@ -20,21 +26,247 @@ const (
 	version = "1.0.0"
 	tool    = "drone-amass"
 	usage   = `
-Parses OWASP Amass JSON output into a lair project.
+Parses OWASP Amass JSON or text output into a lair project.
 Usage:
-  drone-amass [options] <id> <filename>
-  export LAIR_ID=<id>; drone-amass [options] <filename>
+  drone-amass [options] <id> <filename|url>
+  export LAIR_ID=<id>; drone-amass [options] <filename|url>
+  drone-amass -validate [options] <filename|url>
+  drone-amass -restore <backup> [-force] [options] [id]
+  drone-amass -export-only [-export-file <file>] [options] [id]
 Options:
   -version			show version and exit
-  -verbose			enable verbose output
+  -verbose			enable verbose output, including how long each phase took at the end
+  -verbose-errors  on failure, print every layer of error context down to the root cause
+  -quiet-success  for scripts, don't log the Info lines or the final Success line when the run succeeds. warnings
+                  are still logged, and a failed run logs everything as usual
+  -log-file       also write the log to this file, for an audit trail of unattended runs. the file is appended to
+  -log-truncate   with -log-file, start the file over instead of appending to it
+  -verbose-diff-hosts  for every host amass found names for, list the hostnames the import adds (+), the ones
+                  lair already had (=) and the ones it removes (-)
+  -include-raw-addresses  to diagnose results that don't match, print every address of every result exactly
+                  as it is compared (quoted ip, cidr, asn, desc and port) with the host it matched or why it didn't
+  -warnings-as-errors  exit with an error if any warning was logged (hosts that couldn't be imported, failed
+                  mirrors, ...), by default warnings don't change the exit status
+  -fail-on-api-warnings  exit with an error if lair (or a -mirror) accepted the import but warned about it, e.g.
+                  when data protection dropped ports. the warnings are always logged, the import still goes through
   -h              show usage and exit
+  -print-config   print the settings resolved from the environment, arguments and flags and exit. passwords, URL
+                  queries and webhook paths are redacted
+  -validate       only parse and check the results file, print statistics and exit without connecting to lair.
+                  exits with an error if any line could not be parsed, or is in the other schema than -schema-version
   -k              allow insecure SSL connections
-  -tags           a comma separated list of tags to add to every host that is imported
+  -check-auth     before reading the results, check the credentials and access to the project with an export, so a
+                  wrong password or project id fails before a big file is parsed rather than at the import
+  -client-cert    PEM client certificate for lair servers that require mutual TLS, needs -client-key
+  -client-key     PEM private key for -client-cert
+  -tags           a comma separated list of tags to add to every host that is imported. environment variables
+                  like $ENGAGEMENT_ID or ${ENGAGEMENT_ID} are expanded, use $$ for a literal $
   -force-hosts    import all hosts into Lair, default behaviour is to only import
                   hostnames for hosts that already exist in a project
+  -group-by-netblock  tag every host added by -force-hosts with the ASNs of its address, e.g. asn:12345
+  -default-os     OS fingerprint for hosts added by -force-hosts, e.g. unknown, so the OS column in lair isn't empty.
+                  it has the lowest weight so real fingerprints win, existing hosts keep their OS
+  -host-description  add a "description" note with this text to every host added by -force-hosts, e.g. the
+                  engagement name or "discovered by amass". environment variables are expanded like in -tags
+  -merge-mac      set the MAC of matched and forced hosts from a "mac" field on result addresses, which amass doesn't
+                  write but tools producing amass style results for internal networks may. a MAC the host already
+                  has in lair is kept, conflicts and malformed MACs are warned about
+  -coalesce-addresses  attach a result's hostname to a host once, even when several of the result's addresses
+                  match that host, e.g. the same IP reported with different ports or CIDRs. a host never gets the
+                  same hostname twice anyway now, the flag is kept so existing scripts still run
+  -tag-run-id     tag every host the run matched or created with an id for the run, run:<id>, so one run's changes
+                  can be found (and undone) with lair's tag filter. the id is the start time and a random suffix,
+                  e.g. 2024-06-01T12:00:00Z-a3f9, and is also in the import's command entry and the webhook summary
+  -run-id         use this run id instead of generating one, e.g. from a scheduler. implies -tag-run-id
+  -tag-cidr       tag every matched or forced host with the netblocks amass placed its address in, e.g. cidr:1.2.3.0/24
+  -tag-org        tag every matched or forced host with the organisation from its ASN description, cleaned up,
+                  e.g. "AMAZON-02 - Amazon.com, Inc., US" becomes org:Amazon.com
+  -propagate-tags  a comma separated list of tag prefixes, e.g. env:,owner:. tags with one of them on hosts amass
+                  matched are copied to every host in the same lair netblock (the most specific one)
+  -match-by-hostname  when none of a result's addresses match a host, match it to the existing host that already
+                  has its name instead (IP matches always win). the new addresses are recorded in an "amass
+                  addresses" note on that host rather than reported as unmatched or forced in
+  -overwrite-hostnames  send matched hosts with only the hostnames amass found, instead of adding them to the ones
+                  the host has. like -delete-missing, the lair api-server merges them and keeps the old hostnames,
+                  only servers that replace hostnames on import drop them
+  -as-notes      non-destructive review mode. names are recorded in an "amass hostnames (review)" note on hosts
+                  that already exist instead of being added to their hostnames. can't be used with -force-hosts,
+                  -overwrite-hostnames or -delete-missing
+  -annotate-sources  add an "amass sources" note to every host that got hostnames, listing the amass sources
+                  they came from, e.g. "discovered via: Crtsh, DNS"
+  -annotate-first-seen  tag every host added by -force-hosts with the date amass first found its IP, the earliest
+                  timestamp of the results for it, e.g. first-seen:2024-06-01. results without a timestamp are skipped
+  -archive-raw    add an "amass raw results" note to every matched or forced host with the input lines of the
+                  results that matched it, unmodified, so fields drone-amass doesn't map are kept. lines over
+                  8KB are truncated. for amass db exports the line is the name's row of the assets table
+  -hostname-limit-total  the most hostnames a single run may add across all hosts, results are taken in name order
+                  and the rest are skipped with a warning (default 0, unlimited). names a host already has don't count
+  -limit         process at most this many results, after filtering and deduplication. results are taken in name
+                  order so the same input always gives the same partial import (default 0, unlimited)
+  -hostname-count-threshold  flag hosts that end up with more than this many hostnames after the merge
+                  and tag them "review", a lot of names on one IP is often wildcard DNS or shared hosting
+                  (default 0, off)
+  -project-backup  directory the project is backed up to, as exported from lair, before anything is imported.
+                  files are named <project id>-<UTC timestamp>.json and can be given to -restore. an empty
+                  value turns the backup off (default lair-backups)
+  -restore       import a -project-backup file back into its project instead of importing amass results, to roll
+                  back a bad run. shows what it would restore unless -force is given. the project id argument is
+                  optional and must match the backup. lair merges imports, so anything the bad run added stays
+  -export-only   only export the project and print it as indented json, to inspect it before or after a run.
+                  no results file is read and nothing is imported. the project id is the argument or LAIR_ID
+  -export-file   with -export-only, write the project to this file instead of printing it
+  -delete-missing  DANGEROUS. print the hostnames of existing hosts that amass no longer reports for their IP, and
+                  with -force import those hosts without them. hosts amass didn't see at all are never touched. the
+                  whole file counts, not just the results left after filtering, and with -force it refuses -limit, a
+                  -max-runtime cut off or lines that failed to parse. lair merges the hostnames of an import into
+                  its hosts, so the lair api-server keeps them, only servers that replace hostnames drop them
+  -force          confirm destructive operations like -delete-missing, without it they only print a preview
+  -confirm        before importing, print how many hosts and netblocks are about to be imported and ask for
+                  "yes" on the terminal, anything else cancels the import. without a terminal -yes is required
+  -yes            answer the -confirm prompt up front, for automation
+  -keep-wildcards  import wildcard names (like *.example.com) as hostnames instead of skipping them
+  -tag-wildcard-hosts  with -keep-wildcards, tag hosts that got a wildcard name with "wildcard"
   -force-ports    disable data protection in the API server for excessive ports
   -safe-netblocks	disable adding all netblock results from amass, and instead only add netblocks
 					that were already present in the lair project.
+  -synthesize-netblocks  with -force-hosts, add a netblock of this prefix length (16 to 32, e.g. 24) for every range
+                  that at least two forced hosts without a CIDR from amass fall into, and that no netblock
+                  covers yet, so they show up organized in lair (default 0, off)
+  -format        input format of the amass results, one of json, text, db or auto (default auto). text is the
+                  line oriented "name ip cidr asn desc" format, where everything after the name is optional.
+                  db is the amass asset database as json lines of its assets and relations rows, see Amass database
+  -schema-version  2 or 3, read json results as that amass schema version instead of detecting it per line.
+                  2 takes the source from "source", 3 from "sources". a line in the other version stops the run
+  -parse-workers  decode the results with this many goroutines, each taking a chunk of lines, to use more cores on
+                  large files (default 1). results are merged in file order, so the import is the same for any count.
+                  db exports are always decoded on one, their rows refer to each other across the file
+  -strict-json    stop before importing if json results have fields drone-amass doesn't read, listing them, to catch
+                  amass upgrades that change the output. by default unknown fields are ignored
+  -no-normalize   keep names, domains and descriptions exactly as amass wrote them. by default they are trimmed
+                  and runs of whitespace (tabs, newlines) inside them are collapsed to a single space
+  -max-address-per-result  only keep the first N addresses of a result, anything past that is treated as bad data
+                  and skipped with a warning. 0 disables the cap (default 1024)
+  -strip-port     strip a trailing port from result IPs (1.2.3.4:443 or [2001:db8::1]:443) before matching hosts
+  -strip-hostname-ports  strip a trailing port from result names (example.com:8443 or [2001:db8::1]:443), the port
+                  is applied to the result's addresses
+  -import-ports   with -strip-port or -strip-hostname-ports, add the stripped ports as services on the matched hosts
+  -normalize-cidr canonicalize CIDRs to their network address (1.2.3.4/24 becomes 1.2.3.0/24) so netblocks that
+                  only differ in notation aren't duplicated
+  -asn-lookup     a file or http(s) URL of an ASN dataset, used to fill in the ASN and description of addresses
+                  that have a CIDR but no ASN. one "cidr asn description" per line, see README. a downloaded
+                  dataset is cached (e.g. in ~/.cache/drone-amass) and used when the URL can't be reached
+  -asn-format     how ASNs are written into new netblocks, number (12345) or as (AS12345) (default number). the
+                  results can have either form, amass numbers or "AS12345" strings, an unknown ASN is always 0
+  -timeout        timeout for downloading results when an http(s) URL is given instead of a filename (default 1m)
+  -request-timeout  cancel any single lair API request that takes longer than this, e.g. 30s, and retry it. unlike
+                  -max-runtime this doesn't limit the whole run (default 0, no limit). an import that timed out is
+                  only sent again when an export of the project shows lair didn't apply it
+  -request-retries  how many times a lair API export or import that hit -request-timeout is retried (default 2)
+  -proxy          proxy URL to use when downloading results, defaults to the HTTP(S)_PROXY environment variables
+  -input-encoding  character encoding of the results file, one of utf-8, utf-16 (with a BOM), utf-16le, utf-16be,
+                  latin1 or windows-1252 (default utf-8). a utf-8 byte order mark is always stripped
+  -rules          a json file of transformation rules applied to every result before it is merged, see README
+  -hostname-rewrite  a sed style s/pattern/replacement/ rule applied to every result name after the -rules file,
+                  e.g. 's/^ip-([0-9]+)-([0-9]+)\.vendor\.net$/vendor-\1-\2.example.com/'. groups are \1 or $1, every
+                  match is replaced and an i flag ignores case. can be repeated, rules are applied in order
+  -newer-than-file  incremental marker file. results with a timestamp older than the last successful run recorded
+                  in the file are skipped, and the file is updated after a successful import. results without a
+                  timestamp are always imported, and a missing file imports everything
+  -drop-suffix    a comma separated list of domain suffixes, results named the same as or under any of them are
+                  skipped, e.g. akamaiedge.net drops a.akamaiedge.net but not notakamaiedge.net
+  -exclude-ip     a comma separated list of IPs, e.g. a sinkhole or a parking page, results resolving to any of them
+                  are skipped entirely, so they are neither matched nor forced in. the skipped counts are logged per IP
+  -strip-www      treat www.example.com and example.com as the same name when collapsing duplicate results
+  -strip-prefix   a comma separated list of prefixes to ignore the same way, e.g. www.,*.,m. only the comparison
+                  uses the stripped name, the name that is imported is the one amass reported first
+  -source-priority  a comma separated list of amass sources, most trusted first, e.g. crtsh,dns. when a hostname
+                  is reported by several sources only the highest priority one is recorded as its source.
+                  unlisted sources rank last
+  -hostname-include-regex  only import results whose name matches this go regular expression
+  -hostname-exclude-regex  skip results whose name matches this go regular expression, wins over the include regex
+  -min-hostname-length  skip results whose name, without the domain, is shorter than this, e.g. 2 skips
+                  a.example.com but keeps ab.example.com and example.com itself (default 0, off)
+  -scope-file     a file of the domains, CIDRs and IPs in scope, one per line, see README. results whose name isn't
+                  under a scope domain, or with an address outside the scope networks, are dropped
+  -abort-on-scope-violation  with -scope-file, stop before importing anything if any result is out of scope,
+                  and list the offending results in -scope-report
+  -scope-report   where -abort-on-scope-violation lists the results that are out of scope, with the reason for each.
+                  csv if the filename ends in .csv, json otherwise (default scope-violations.json)
+  -ignore-private-ips  skip private and reserved addresses (10/8, 192.168/16, loopback, link local, ...) for both
+                  matching and -force-hosts. results left without any address are skipped
+  -address-family  ipv4, ipv6 or both (default both). only addresses of that family are used for matching and
+                  -force-hosts, results left without any address are skipped
+  -fail-on-wildcard  exit with an error, before importing anything, if any result has a wildcard name
+  -fail-on-empty  exit with an error if the results file has no results at all (a warning is logged otherwise).
+                  a file whose results were all filtered out only logs a warning
+  -skip-import-on-parse-errors  don't import anything if any line of the results file could not be parsed.
+                  by default unparseable lines are skipped with a warning and the rest of the file is imported
+  -mode           best-effort or fail-fast (default best-effort). best-effort skips unparseable lines, retries
+                  rejected batches record by record and only warns about failing mirrors. fail-fast implies
+                  -skip-import-on-parse-errors and -fail-on-empty, doesn't retry and fails the run on a failing mirror.
+                  use fail-fast when a partial import is worse than none, best-effort to get as much in as possible
+  -show-scope-summary  before importing, print the root domains found in the results with their counts
+  -summary-by-asn  before importing, print the discovered netblocks grouped by ASN, with counts and descriptions
+  -timeline       hour or day. before importing, print how many results were discovered in every UTC hour or day,
+                  as a histogram, from the timestamps newer amass versions write
+  -report-format  format of the summary outputs (-show-scope-summary, -summary-by-asn, -timeline, -only-new, the
+                  -delete-missing preview and the hosts and netblocks lair didn't have), one of text, json, csv or
+                  markdown (default text). json and csv print all of them as one document when the run ends, a
+                  json object with a field per report or one csv table whose first column names the report
+  -output-csv     write every parsed result to this csv file (name, ip, cidr, asn, source, domain), whether or not it is imported.
+                  it is written right after parsing, before -rules or any other filtering
+  -hosts-out      write every distinct hostname to this file, one per line, sorted and lower cased, to feed other
+                  tools like httpx. wildcard names are left out. written before the import, like -output-csv
+  -ips-out        write every distinct IP address to this file, one per line in numeric order, e.g. for nmap -iL
+                  for both lists a filename ending in .jsonl gets json lines, {"hostname": ...} or {"ip": ...}
+  -stream-lists   write -hosts-out and -ips-out while the results are parsed, in the order they're found, instead
+                  of sorted after the merge, for very large inputs. each result gets the usual whitespace, port and
+                  -max-address-per-result clean up first, but the lists are written before any filtering, so it can't
+                  be used with a flag that drops or collapses results (-scope-file, -drop-suffix, -ignore-private-ips,
+                  -rules, -limit and so on). repeats are skipped, which keeps every distinct entry in memory
+  -report-unmatched  write the results that didn't match an existing host to this file, with the reason for each.
+                  csv if the filename ends in .csv, json otherwise
+  -dedupe-report  write every duplicate result that was collapsed and every CIDR -normalize-cidr rewrote to this
+                  file, with the original and canonical forms and why. csv if the filename ends in .csv, json otherwise
+  -skip-dedupe    don't look for duplicate results before merging, for huge inputs that are known to be unique
+                  already (e.g. deduplicated upstream). duplicates that do slip through are merged twice, which
+                  can leave the same hostname on a host more than once. can't be used with -strip-www or -strip-prefix
+  -ct-dedup       also collapse certificate transparency artifacts (results only from Crtsh, CertSpotter, Censys,
+                  FacebookCT, GoogleCT or Entrust): names without addresses that another result has, and wildcard
+                  names like *.foo.example.com when foo.example.com was found too. they are in -dedupe-report
+  -collapse-cnames  import a CNAME chain as the last name of it that was found, with the aliases' addresses, instead
+                  of every hop, e.g. www.example.com -> edge.cdn.net as edge.cdn.net. only amass db exports
+                  (-format db) have the cname_record relations it needs. collapsed aliases are in -dedupe-report
+  -only-new       after import, list the hosts and netblocks that were newly created (rather than updated)
+  -report-diff-json  after import, write what it changed to this json file for dashboards: the added hosts, the
+                  added hostnames per host, the added netblocks and the hosts and netblocks that were skipped. the
+                  layout is versioned with "schemaVersion", see README
+  -output-lair-url  after import, print a link to every host that was created or updated, to jump straight to it
+  -lair-url-template  go text/template for the -output-lair-url links, for lair deployments where the UI isn't
+                  served from the API server. it can use .Server (scheme and host of LAIR_API_SERVER), .ProjectID,
+                  .HostID and .IP (default {{.Server}}/project/{{.ProjectID}}/hosts/{{.HostID}})
+  -batch-size     split the import into several requests with at most this many hosts each (default 0, a single request)
+                  when lair rejects a request, its netblocks and hosts are retried one at a time and the ones
+                  that are still refused are listed, the run then exits with status 2
+  -import-order   together, hosts-first or netblocks-first (default together). together sends the netblocks in the
+                  same request as the (first batch of) hosts, the others send them in a request of their own before
+                  or after the hosts, to work around lair servers that mishandle one or the other, see Bugs
+  -split-import   import the hosts and the netblocks separately (in -import-order) and report each on its own, so
+                  a failed netblock import doesn't cost the hosts or the other way around. if only one of them
+                  fails the run exits with status 2
+  -resume        checkpoint file for large batched imports. every batch lair accepts is recorded in it, and when an
+                  interrupted or partly failed import is rerun with the same file, project and results the hosts
+                  and netblocks that already made it are skipped. a checkpoint for anything else is ignored with a
+                  warning, and it is removed once an import completes
+  -import-delay   how long to wait between import requests, e.g. 5s, to give the lair server some breathing room (default 0)
+  -mirror         also import the merged project into this lair API server, given like LAIR_API_SERVER with
+                  credentials. can be repeated. a failing mirror is reported but doesn't fail the run
+  -max-runtime    wall clock budget for the run, e.g. 10m. when it runs out parsing stops, what was parsed is imported,
+                  no further batches are started and the tool exits with status 2 (partial) (default 0, no limit)
+  -webhook        POST a json summary of the run to this URL when it finishes, on success or failure
+  -webhook-on     which runs are posted to the -webhook, one of always, failure or never (default always).
+                  failure posts failed and partial runs but not clean successes
+  -webhook-template  a go text/template file used to render the webhook payload instead of the default json
 `
 )
 
@@ -43,51 +275,776 @@ Options:
 // example command: "amass enum -json out.json -d example.com"
 // drones behave weirdly in the best of times, so export/backup your project before running to avoid any data loss.
 // CURRENT BUGS:
-// - netblock and host imports do not work if there is not already at least one host and/or netblock added to the lair project before import
 // - when hosts are added with -force-hosts, they will show up with the green status for some reason
 
+// the -mode values. best-effort skips what it can't handle and carries on, fail-fast stops the run instead
+const (
+	modeBestEffort = "best-effort"
+	modeFailFast   = "fail-fast"
+)
+
+// exitPartial is the exit status when -max-runtime stopped the run before everything was imported
+const exitPartial = 2
+
+// partialError is returned by run when the -max-runtime budget ran out. whatever was done before that was imported
+type partialError struct {
+	reason string
+}
+
+func (e *partialError) Error() string {
+	return e.reason
+}
+
+// warnings counts the warnings logged so far, for -warnings-as-errors
+var warnings int32
+
+// warnf logs a warning and counts it
+func warnf(format string, v ...interface{}) {
+	atomic.AddInt32(&warnings, 1)
+	log.Printf("Warning: "+format, v...)
+}
+
+func warningCount() int {
+	return int(atomic.LoadInt32(&warnings))
+}
+
+// orgSuffixes are the legal forms dropped from the end of an organisation name by -tag-org
+var orgSuffixes = []string{"inc", "llc", "ltd", "limited", "corp", "corporation", "co", "gmbh", "ag", "sa", "sas", "bv", "plc"}
+
+// orgTag is the -tag-org tag for an ASN description, e.g. "AMAZON-02 - Amazon.com, Inc., US" becomes
+// "org:Amazon.com". the AS handle before " - ", a trailing country code and legal forms are dropped and spaces
+// become dashes so the tag is easy to filter on. an empty description gives no tag
+func orgTag(desc string) string {
+	org := collapseWhitespace(desc)
+	if i := strings.Index(org, " - "); i >= 0 {
+		org = org[i+3:]
+	}
+	parts := strings.Split(org, ",")
+	// "..., US"
+	if last := strings.TrimSpace(parts[len(parts)-1]); len(parts) > 1 && len(last) == 2 && strings.ToUpper(last) == last {
+		parts = parts[:len(parts)-1]
+	}
+	org = strings.Join(parts, ",")
+	for {
+		trimmed := strings.TrimRight(org, " ,.")
+		fields := strings.Fields(trimmed)
+		if len(fields) < 2 {
+			org = trimmed
+			break
+		}
+		last := strings.ToLower(strings.Trim(fields[len(fields)-1], ",."))
+		found := false
+		for _, suffix := range orgSuffixes {
+			if last == suffix {
+				found = true
+				break
+			}
+		}
+		if !found {
+			org = trimmed
+			break
+		}
+		org = strings.Join(fields[:len(fields)-1], " ")
+	}
+	if org == "" {
+		return ""
+	}
+	return "org:" + strings.Join(strings.Fields(org), "-")
+}
+
+// quietLog buffers the log of a -quiet-success run
+type quietLog struct {
+	bytes.Buffer
+}
+
+// flush writes the buffered log to stderr. after a successful run only the warnings are written,
+// the informational lines are dropped
+func (q *quietLog) flush(all bool) {
+	for _, line := range strings.SplitAfter(q.String(), "\n") {
+		if all || strings.Contains(line, "Warning: ") {
+			os.Stderr.WriteString(line)
+		}
+	}
+}
+
+// cidrTag is the -tag-cidr tag for a host in the given netblock, always in canonical notation
+func cidrTag(cidr string) string {
+	return "cidr:" + canonicalCIDR(cidr)
+}
+
+// firstSeenTag is the -annotate-first-seen tag for a host amass first found at t, the UTC date, e.g. first-seen:2024-06-01
+func firstSeenTag(t time.Time) string {
+	return "first-seen:" + t.UTC().Format("2006-01-02")
+}
+
+// defaultOS is the -default-os fingerprint for forced hosts. the weight is low so any real fingerprint
+// lair gets for the host later, from nmap for example, wins over it
+func defaultOS(fingerprint string) lair.OS {
+	if fingerprint == "" {
+		return lair.OS{}
+	}
+	return lair.OS{Tool: tool, Weight: 1, Fingerprint: fingerprint}
+}
+
+// wildcardTag marks hosts that got a hostname from a wildcard result, with -keep-wildcards and -tag-wildcard-hosts
+const wildcardTag = "wildcard"
+
+// reviewTag marks hosts over -hostname-count-threshold for an analyst to look at
+const reviewTag = "review"
+
+// notifier reports the outcome of the run to the -webhook endpoint, if one was given
+var notifier = &webhook{
+	summary: webhookSummary{Tool: tool, Version: version},
+}
+
+// fatalf reports a failed run to the webhook and then exits like log.Fatalf
+func fatalf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	notifier.notify("failure", msg)
+	log.Fatal(msg)
+}
+
+// options holds the settings given on the command line
+type options struct {
+	verbose            bool
+	verboseErrors      bool
+	verboseDiffHosts   bool
+	rawAddresses       bool
+	quietSuccess       bool
+	logFile            string
+	logTruncate        bool
+	warningsAsErrors   bool
+	failOnAPIWarnings  bool
+	validate           bool
+	printConfig        bool
+	insecureSSL        bool
+	checkAuth          bool
+	clientCert         string
+	clientKey          string
+	forcePorts         bool
+	forceHosts         bool
+	groupByNetblock    bool
+	tagCIDR            bool
+	tagOrg             bool
+	propagateTags      string
+	overwriteHostnames bool
+	matchByHostname    bool
+	asNotes            bool
+	annotateSources    bool
+	annotateFirstSeen  bool
+	archiveRaw         bool
+	hostnameLimit      int
+	hostnameThreshold  int
+	synthPrefix        int
+	defaultOS          string
+	hostDescription    string
+	mergeMAC           bool
+	coalesceAddresses  bool
+	deleteMissing      bool
+	projectBackup      string
+	restore            string
+	exportOnly         bool
+	exportFile         string
+	force              bool
+	keepWildcards      bool
+	tagWildcardHosts   bool
+	safeNetblocks      bool
+	tags               string
+	format             string
+	schemaVersion      string
+	parseWorkers       int
+	strictJSON         bool
+	noNormalize        bool
+	stripPort          bool
+	stripHostnamePorts bool
+	maxAddresses       int
+	normalizeCIDR      bool
+	asnLookup          string
+	asnFormat          string
+	importPorts        bool
+	timeout            time.Duration
+	requestTimeout     time.Duration
+	requestRetries     int
+	proxy              string
+	inputEncoding      string
+	rulesFile          string
+	hostnameRewrites   stringList
+	newerThanFile      string
+	dropSuffix         string
+	excludeIP          string
+	stripWWW           bool
+	stripPrefix        string
+	ignorePrivateIPs   bool
+	scopeFile          string
+	abortOnScope       bool
+	scopeReport        string
+	addressFamily      string
+	includeRegex       string
+	excludeRegex       string
+	minNameLength      int
+	failOnWildcard     bool
+	failOnEmpty        bool
+	mode               string
+	skipOnParseErrors  bool
+	showScope          bool
+	summaryByASN       bool
+	timeline           string
+	reportFormat       string
+	outputCSV          string
+	hostsOut           string
+	ipsOut             string
+	streamLists        bool
+	reportUnmatched    string
+	dedupeReport       string
+	skipDedupe         bool
+	ctDedup            bool
+	collapseCNAMEs     bool
+	limit              int
+	onlyNew            bool
+	reportDiffJSON     string
+	outputLairURL      bool
+	linkTemplate       string
+	batchSize          int
+	importOrder        string
+	splitImport        bool
+	resume             string
+	confirm            bool
+	yes                bool
+	importDelay        time.Duration
+	mirrors            stringList
+	sourcePriority     string
+	maxRuntime         time.Duration
+	webhookURL         string
+	webhookTemplate    string
+	webhookOn          string
+	tagRunID           bool
+	runID              string
+}
+
 // this is what the amass json output format looks like:
 type amassResult struct {
-	Name      string `json:"name"`
-	Domain    string `json:"domain"`
-	Addresses []struct {
-		IP   string `json:"ip"`
-		Cidr string `json:"cidr"`
-		Asn  int    `json:"asn"`
-		Desc string `json:"desc"`
-	} `json:"addresses"`
-	Tag    string `json:"tag"`
-	Source string `json:"source"`
+	Name      string         `json:"name"`
+	Domain    string         `json:"domain"`
+	Addresses []amassAddress `json:"addresses"`
+	Tag       string         `json:"tag"`
+	Source    string         `json:"source"`
+	Sources   []string       `json:"sources"`
+	Timestamp string         `json:"timestamp,omitempty"`
+	// CNAMEs are the names this one is an alias for, only amass db exports have them
+	CNAMEs []string `json:"-"`
+	// Raw is the input line the result was parsed from, untouched, for -archive-raw. for db exports
+	// it is the row of the name's asset
+	Raw string `json:"-"`
+}
+
+// fillSources makes Source and Sources agree, older amass versions (schema v2) write a single "source"
+// while newer ones (schema v3) write a "sources" list
+func (r *amassResult) fillSources() {
+	if len(r.Sources) == 0 && r.Source != "" {
+		r.Sources = []string{r.Source}
+	}
+	if r.Source == "" && len(r.Sources) > 0 {
+		r.Source = strings.Join(r.Sources, ",")
+	}
+}
+
+// discovered returns when amass found the result, if the output has a timestamp for it
+func (r amassResult) discovered() (time.Time, bool) {
+	if r.Timestamp == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, r.Timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+type amassAddress struct {
+	IP   string    `json:"ip"`
+	Cidr string    `json:"cidr"`
+	Asn  asnNumber `json:"asn"`
+	Desc string    `json:"desc"`
+	// MAC isn't written by amass, but by tools that produce amass style results on internal networks
+	MAC string `json:"mac,omitempty"`
+	// Port is split off IP by -strip-port, amass itself never includes one
+	Port int `json:"-"`
 }
 
 // parse amass results file
-// this recursive function takes the byte array "data" which is the raw data read from the amass output file which is jsonlines format
-// it takes this data and decodes each json line, and returns it
-func parseJsonLines(data []byte, f func(amassResult)) {
-	dec := json.NewDecoder(strings.NewReader(string(data)))
-	for {
+// this function takes the byte array "data" which is the raw data read from the amass output file which is jsonlines format
+// it decodes each json line and hands it to f. lines that don't decode are skipped and returned together as lineErrors
+func parseJsonLines(data []byte, f func(amassResult) bool) error {
+	var bad lineErrors
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
 		var result amassResult
-		err := dec.Decode(&result)
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			bad = append(bad, &lineError{line: i + 1, err: err})
+			continue
+		}
+		result.fillSources()
+		result.Raw = line
+		if !f(result) {
+			break
+		}
+	}
+	return bad.errOrNil()
+}
+
+// schemaParser returns a json parser for -schema-version that skips the schema detection: sources are
+// read from that version's field only ("source" for 2, "sources" for 3). a line that only has the other
+// version's field means the file isn't what the user said it is, so that stops the parse
+func schemaParser(version string) parser {
+	own, other := "source", "sources"
+	if version == "3" {
+		own, other = other, own
+	}
+	return func(data []byte, f func(amassResult) bool) error {
+		var bad lineErrors
+		for i, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			fields := map[string]json.RawMessage{}
+			if err := json.Unmarshal([]byte(line), &fields); err != nil {
+				bad = append(bad, &lineError{line: i + 1, err: err})
+				continue
+			}
+			_, hasOwn := fields[own]
+			if _, hasOther := fields[other]; hasOther && !hasOwn {
+				return fmt.Errorf("line %d has %q, which is not amass schema %s as given with -schema-version", i+1, other, version)
+			}
+			var result amassResult
+			if err := json.Unmarshal([]byte(line), &result); err != nil {
+				bad = append(bad, &lineError{line: i + 1, err: err})
+				continue
+			}
+			if version == "3" {
+				result.Source = ""
+			} else {
+				result.Sources = nil
+			}
+			result.fillSources()
+			result.Raw = line
+			if !f(result) {
+				break
+			}
+		}
+		return bad.errOrNil()
+	}
+}
+
+// parse amass results in the line oriented text format, which looks like "name ip cidr asn desc".
+// only the name is required, this also covers plain "amass -o" output which only has names.
+// the description is everything after the asn, so it may contain spaces
+func parseTextLines(data []byte, f func(amassResult) bool) error {
+	var bad lineErrors
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result, err := parseTextLine(line)
 		if err != nil {
-			if err == io.EOF {
+			bad = append(bad, &lineError{line: i + 1, err: err})
+			continue
+		}
+		result.Raw = line
+		if !f(result) {
+			break
+		}
+	}
+	return bad.errOrNil()
+}
+
+// parseTextLine parses a single non-empty line of the text format
+func parseTextLine(line string) (amassResult, error) {
+	fields := strings.Fields(line)
+	result := amassResult{Name: fields[0]}
+	if len(fields) > 1 {
+		cidr := ""
+		if len(fields) > 2 {
+			cidr = fields[2]
+		}
+		var asn asnNumber
+		if len(fields) > 3 {
+			n, err := parseASN(fields[3])
+			if err != nil {
+				return result, fmt.Errorf("invalid ASN: %w", err)
+			}
+			asn = n
+		}
+		desc := ""
+		if len(fields) > 4 {
+			desc = strings.Join(fields[4:], " ")
+		}
+		// "amass -ip" separates multiple addresses with commas
+		for _, ip := range strings.Split(fields[1], ",") {
+			if ip == "" {
+				continue
+			}
+			result.Addresses = append(result.Addresses, amassAddress{IP: ip, Cidr: cidr, Asn: asn, Desc: desc})
+		}
+	}
+	return result, nil
+}
+
+// expandTag replaces $VAR and ${VAR} in a tag with the value from the environment, so tags like
+// "engagement:$ENGAGEMENT_ID" can be parameterized in CI. "$$" is kept as a literal "$"
+func expandTag(tag string) string {
+	return os.Expand(tag, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+}
+
+// wildcardNames returns the distinct result names that contain a wildcard
+func wildcardNames(results []amassResult) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, r := range results {
+		if strings.Contains(r.Name, "*") && !seen[r.Name] {
+			seen[r.Name] = true
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// newLairClient validates a lair API server URL, which carries the credentials, and creates a client for it.
+// with a client certificate or a request timeout the drone's own client is used instead of the upstream one
+func newLairClient(lairURL string, insecureSSL bool, cert *tls.Certificate, timeout time.Duration) (lairAPI, error) {
+	// validate given lair URL
+	u, err := url.Parse(lairURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing URL: %w", err)
+	}
+	// validate given credentials
+	if u.User == nil {
+		return nil, errors.New("missing username and/or password")
+	}
+	user := u.User.Username()
+	pass, _ := u.User.Password()
+	if user == "" || pass == "" {
+		return nil, errors.New("missing username and/or password")
+	}
+	if cert != nil || timeout > 0 {
+		return newAPIClient(user, pass, u, insecureSSL, cert, timeout), nil
+	}
+	// create lair API client
+	c, err := client.New(&client.COptions{
+		User:               user,
+		Password:           pass,
+		Host:               u.Host,
+		Scheme:             u.Scheme,
+		InsecureSkipVerify: insecureSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error setting up client: %w", err)
+	}
+	return c, nil
+}
+
+// redactURL hides the password and the query of a URL so it can be logged, presigned download URLs
+// carry their signature in the query
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "xxxxx"
+	}
+	return u.Redacted()
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// appendUnique appends the values that aren't in list yet
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, l := range list {
+			if l == v {
+				found = true
 				break
 			}
-			log.Fatal(err)
 		}
-		f(result)
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// contains reports whether list has s
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// amassNotes turns the names collected with -as-notes into a single flagged note for review
+func amassNotes(names []string) []lair.Note {
+	if len(names) == 0 {
+		return nil
+	}
+	return []lair.Note{{
+		Title:          "amass hostnames (review)",
+		Content:        strings.Join(names, "\n"),
+		LastModifiedBy: tool,
+	}}
+}
+
+// descriptionNote is the -host-description note for forced hosts, nothing when no description was given
+func descriptionNote(description string) []lair.Note {
+	if description == "" {
+		return nil
+	}
+	return []lair.Note{{
+		Title:          "description",
+		Content:        description,
+		LastModifiedBy: tool,
+	}}
+}
+
+// sourcesNote is the -annotate-sources provenance note, every source that contributed the host's hostnames
+func sourcesNote(sources []string) []lair.Note {
+	if len(sources) == 0 {
+		return nil
+	}
+	sorted := append([]string{}, sources...)
+	sort.Strings(sorted)
+	return []lair.Note{{
+		Title:          "amass sources",
+		Content:        "discovered via: " + strings.Join(sorted, ", "),
+		LastModifiedBy: tool,
+	}}
+}
+
+// addressNote is the -match-by-hostname note, the other addresses amass resolved the host's names to
+func addressNote(lines []string) []lair.Note {
+	if len(lines) == 0 {
+		return nil
+	}
+	return []lair.Note{{
+		Title:          "amass addresses",
+		Content:        strings.Join(lines, "\n"),
+		LastModifiedBy: tool,
+	}}
+}
+
+// maxRawResult is how much of a single result -archive-raw keeps, amass lines with thousands of
+// addresses would otherwise make notes lair struggles to display
+const maxRawResult = 8192
+
+// rawNote is the -archive-raw note, the input lines of every result that matched the host
+func rawNote(lines []string) []lair.Note {
+	if len(lines) == 0 {
+		return nil
+	}
+	kept := []string{}
+	for _, line := range lines {
+		if len(line) > maxRawResult {
+			line = fmt.Sprintf("%s... (truncated, %d bytes)", line[:maxRawResult], len(line))
+		}
+		kept = append(kept, line)
+	}
+	return []lair.Note{{
+		Title:          "amass raw results",
+		Content:        strings.Join(kept, "\n"),
+		LastModifiedBy: tool,
+	}}
+}
+
+// hostNotesFor puts together the notes drone-amass adds to an existing host
+func hostNotesFor(names, sources, addresses, raw []string) []lair.Note {
+	notes := amassNotes(names)
+	notes = append(notes, sourcesNote(sources)...)
+	notes = append(notes, addressNote(addresses)...)
+	return append(notes, rawNote(raw)...)
+}
+
+// withoutName returns results without the ones named name
+func withoutName(results []amassResult, name string) []amassResult {
+	kept := []amassResult{}
+	for _, r := range results {
+		if r.Name != name {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// portServices turns the ports found for a host into lair services, each port only once
+func portServices(ports []int) []lair.Service {
+	var services []lair.Service
+	seen := map[int]bool{}
+	for _, port := range ports {
+		if seen[port] {
+			continue
+		}
+		seen[port] = true
+		services = append(services, lair.Service{
+			Port:           port,
+			Protocol:       "tcp",
+			Service:        "unknown",
+			Status:         lair.StatusGrey,
+			LastModifiedBy: tool,
+		})
 	}
+	return services
+}
+
+// detectFormat guesses the amass output format from the file contents, json lines always start with an object
+func detectFormat(data []byte) string {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		// db exports are json lines too, but of the database's asset and relation rows
+		if isDBRecord(strings.SplitN(trimmed, "\n", 2)[0]) {
+			return "db"
+		}
+		return "json"
+	}
+	return "text"
 }
 
 func main() {
+	opts := options{}
 	showVersion := flag.Bool("version", false, "")
-	verboseOut := flag.Bool("verbose", false, "")
-	insecureSSL := flag.Bool("k", false, "")
-	forcePorts := flag.Bool("force-ports", false, "")
-	forceHosts := flag.Bool("force-hosts", false, "")
-	safeNetblocks := flag.Bool("safe-netblocks", false, "")
-	tags := flag.String("tags", "", "")
+	flag.BoolVar(&opts.verbose, "verbose", false, "")
+	flag.BoolVar(&opts.verboseErrors, "verbose-errors", false, "")
+	flag.BoolVar(&opts.verboseDiffHosts, "verbose-diff-hosts", false, "")
+	flag.BoolVar(&opts.rawAddresses, "include-raw-addresses", false, "")
+	flag.BoolVar(&opts.quietSuccess, "quiet-success", false, "")
+	flag.StringVar(&opts.logFile, "log-file", "", "")
+	flag.BoolVar(&opts.logTruncate, "log-truncate", false, "")
+	flag.BoolVar(&opts.warningsAsErrors, "warnings-as-errors", false, "")
+	flag.BoolVar(&opts.failOnAPIWarnings, "fail-on-api-warnings", false, "")
+	flag.BoolVar(&opts.validate, "validate", false, "")
+	flag.BoolVar(&opts.printConfig, "print-config", false, "")
+	flag.BoolVar(&opts.insecureSSL, "k", false, "")
+	flag.BoolVar(&opts.checkAuth, "check-auth", false, "")
+	flag.StringVar(&opts.clientCert, "client-cert", "", "")
+	flag.StringVar(&opts.clientKey, "client-key", "", "")
+	flag.BoolVar(&opts.forcePorts, "force-ports", false, "")
+	flag.BoolVar(&opts.forceHosts, "force-hosts", false, "")
+	flag.BoolVar(&opts.tagCIDR, "tag-cidr", false, "")
+	flag.BoolVar(&opts.tagOrg, "tag-org", false, "")
+	flag.StringVar(&opts.propagateTags, "propagate-tags", "", "")
+	flag.BoolVar(&opts.groupByNetblock, "group-by-netblock", false, "")
+	flag.BoolVar(&opts.asNotes, "as-notes", false, "")
+	flag.BoolVar(&opts.annotateSources, "annotate-sources", false, "")
+	flag.BoolVar(&opts.annotateFirstSeen, "annotate-first-seen", false, "")
+	flag.BoolVar(&opts.archiveRaw, "archive-raw", false, "")
+	flag.BoolVar(&opts.matchByHostname, "match-by-hostname", false, "")
+	flag.BoolVar(&opts.overwriteHostnames, "overwrite-hostnames", false, "")
+	flag.IntVar(&opts.hostnameLimit, "hostname-limit-total", 0, "")
+	flag.IntVar(&opts.hostnameThreshold, "hostname-count-threshold", 0, "")
+	flag.IntVar(&opts.synthPrefix, "synthesize-netblocks", 0, "")
+	flag.StringVar(&opts.defaultOS, "default-os", "", "")
+	flag.StringVar(&opts.hostDescription, "host-description", "", "")
+	flag.BoolVar(&opts.mergeMAC, "merge-mac", false, "")
+	flag.BoolVar(&opts.tagRunID, "tag-run-id", false, "")
+	flag.StringVar(&opts.runID, "run-id", "", "")
+	flag.BoolVar(&opts.coalesceAddresses, "coalesce-addresses", false, "")
+	flag.StringVar(&opts.projectBackup, "project-backup", "lair-backups", "")
+	flag.StringVar(&opts.restore, "restore", "", "")
+	flag.BoolVar(&opts.exportOnly, "export-only", false, "")
+	flag.StringVar(&opts.exportFile, "export-file", "", "")
+	flag.BoolVar(&opts.deleteMissing, "delete-missing", false, "")
+	flag.BoolVar(&opts.force, "force", false, "")
+	flag.BoolVar(&opts.keepWildcards, "keep-wildcards", false, "")
+	flag.BoolVar(&opts.tagWildcardHosts, "tag-wildcard-hosts", false, "")
+	flag.BoolVar(&opts.safeNetblocks, "safe-netblocks", false, "")
+	flag.StringVar(&opts.tags, "tags", "", "")
+	flag.StringVar(&opts.format, "format", "auto", "")
+	flag.StringVar(&opts.schemaVersion, "schema-version", "", "")
+	flag.IntVar(&opts.parseWorkers, "parse-workers", 1, "")
+	flag.BoolVar(&opts.strictJSON, "strict-json", false, "")
+	flag.BoolVar(&opts.noNormalize, "no-normalize", false, "")
+	flag.BoolVar(&opts.stripPort, "strip-port", false, "")
+	flag.BoolVar(&opts.stripHostnamePorts, "strip-hostname-ports", false, "")
+	flag.IntVar(&opts.maxAddresses, "max-address-per-result", 1024, "")
+	flag.BoolVar(&opts.normalizeCIDR, "normalize-cidr", false, "")
+	flag.StringVar(&opts.asnLookup, "asn-lookup", "", "")
+	flag.StringVar(&opts.asnFormat, "asn-format", asnFormatNumber, "")
+	flag.BoolVar(&opts.importPorts, "import-ports", false, "")
+	flag.DurationVar(&opts.timeout, "timeout", time.Minute, "")
+	flag.DurationVar(&opts.requestTimeout, "request-timeout", 0, "")
+	flag.IntVar(&opts.requestRetries, "request-retries", 2, "")
+	flag.StringVar(&opts.proxy, "proxy", "", "")
+	flag.StringVar(&opts.inputEncoding, "input-encoding", "utf-8", "")
+	flag.StringVar(&opts.rulesFile, "rules", "", "")
+	flag.Var(&opts.hostnameRewrites, "hostname-rewrite", "")
+	flag.StringVar(&opts.newerThanFile, "newer-than-file", "", "")
+	flag.StringVar(&opts.dropSuffix, "drop-suffix", "", "")
+	flag.StringVar(&opts.excludeIP, "exclude-ip", "", "")
+	flag.BoolVar(&opts.stripWWW, "strip-www", false, "")
+	flag.StringVar(&opts.stripPrefix, "strip-prefix", "", "")
+	flag.StringVar(&opts.sourcePriority, "source-priority", "", "")
+	flag.BoolVar(&opts.ignorePrivateIPs, "ignore-private-ips", false, "")
+	flag.StringVar(&opts.scopeFile, "scope-file", "", "")
+	flag.BoolVar(&opts.abortOnScope, "abort-on-scope-violation", false, "")
+	flag.StringVar(&opts.scopeReport, "scope-report", "scope-violations.json", "")
+	flag.StringVar(&opts.addressFamily, "address-family", familyBoth, "")
+	flag.StringVar(&opts.includeRegex, "hostname-include-regex", "", "")
+	flag.StringVar(&opts.excludeRegex, "hostname-exclude-regex", "", "")
+	flag.IntVar(&opts.minNameLength, "min-hostname-length", 0, "")
+	flag.BoolVar(&opts.failOnWildcard, "fail-on-wildcard", false, "")
+	flag.BoolVar(&opts.skipOnParseErrors, "skip-import-on-parse-errors", false, "")
+	flag.BoolVar(&opts.failOnEmpty, "fail-on-empty", false, "")
+	flag.StringVar(&opts.mode, "mode", modeBestEffort, "")
+	flag.BoolVar(&opts.showScope, "show-scope-summary", false, "")
+	flag.BoolVar(&opts.summaryByASN, "summary-by-asn", false, "")
+	flag.StringVar(&opts.timeline, "timeline", "", "")
+	flag.StringVar(&opts.reportFormat, "report-format", "text", "")
+	flag.StringVar(&opts.outputCSV, "output-csv", "", "")
+	flag.StringVar(&opts.hostsOut, "hosts-out", "", "")
+	flag.StringVar(&opts.ipsOut, "ips-out", "", "")
+	flag.BoolVar(&opts.streamLists, "stream-lists", false, "")
+	flag.StringVar(&opts.reportUnmatched, "report-unmatched", "", "")
+	flag.StringVar(&opts.dedupeReport, "dedupe-report", "", "")
+	flag.BoolVar(&opts.skipDedupe, "skip-dedupe", false, "")
+	flag.BoolVar(&opts.ctDedup, "ct-dedup", false, "")
+	flag.BoolVar(&opts.collapseCNAMEs, "collapse-cnames", false, "")
+	flag.IntVar(&opts.limit, "limit", 0, "")
+	flag.BoolVar(&opts.onlyNew, "only-new", false, "")
+	flag.StringVar(&opts.reportDiffJSON, "report-diff-json", "", "")
+	flag.BoolVar(&opts.outputLairURL, "output-lair-url", false, "")
+	flag.StringVar(&opts.linkTemplate, "lair-url-template", defaultLinkTemplate, "")
+	flag.IntVar(&opts.batchSize, "batch-size", 0, "")
+	flag.StringVar(&opts.importOrder, "import-order", orderTogether, "")
+	flag.BoolVar(&opts.splitImport, "split-import", false, "")
+	flag.StringVar(&opts.resume, "resume", "", "")
+	flag.BoolVar(&opts.confirm, "confirm", false, "")
+	flag.BoolVar(&opts.yes, "yes", false, "")
+	flag.DurationVar(&opts.importDelay, "import-delay", 0, "")
+	flag.Var(&opts.mirrors, "mirror", "")
+	flag.DurationVar(&opts.maxRuntime, "max-runtime", 0, "")
+	flag.StringVar(&opts.webhookURL, "webhook", "", "")
+	flag.StringVar(&opts.webhookTemplate, "webhook-template", "", "")
+	flag.StringVar(&opts.webhookOn, "webhook-on", webhookAlways, "")
 	flag.Usage = func() {
-		fmt.Println(usage)
+		fmt.Print(usage)
 	}
 	flag.Parse()
 	// if version flag given, print version and exit
@@ -95,75 +1052,705 @@ func main() {
 		log.Println(version)
 		os.Exit(0)
 	}
+	if opts.printConfig {
+		printConfig(flag.Args())
+		os.Exit(0)
+	}
+	// -log-file keeps a copy of the log for unattended runs, on top of stderr
+	var logOutput io.Writer = os.Stderr
+	var logFile io.Writer
+	if opts.logFile != "" {
+		mode := os.O_APPEND
+		if opts.logTruncate {
+			mode = os.O_TRUNC
+		}
+		f, err := os.OpenFile(opts.logFile, os.O_CREATE|os.O_WRONLY|mode, 0644)
+		if err != nil {
+			fatalf("Fatal: setup: could not open log file: %s", err.Error())
+		}
+		logFile = f
+		logOutput = io.MultiWriter(os.Stderr, f)
+		log.SetOutput(logOutput)
+	}
+	// -restore rolls a project back to a backup instead of importing amass results
+	if opts.restore != "" {
+		if err := restore(opts, flag.Args()); err != nil {
+			fatalf("Fatal: %s", err.Error())
+		}
+		log.Println("Success: Operation completed successfully")
+		os.Exit(0)
+	}
+	if opts.exportOnly {
+		if err := exportOnly(opts, flag.Args()); err != nil {
+			fatalf("Fatal: %s", err.Error())
+		}
+		os.Exit(0)
+	}
+	// -validate only checks the file, it never talks to lair
+	if opts.validate {
+		if err := validate(opts, flag.Args()); err != nil {
+			fatalf("Fatal: %s", err.Error())
+		}
+		os.Exit(0)
+	}
+	// -quiet-success holds the log back until the outcome is known, a failed run still gets all of it
+	var quiet *quietLog
+	if opts.quietSuccess {
+		quiet = &quietLog{}
+		// the log file is an audit trail, it always gets everything
+		if logFile != nil {
+			log.SetOutput(io.MultiWriter(quiet, logFile))
+		} else {
+			log.SetOutput(quiet)
+		}
+	}
+	err := run(opts, flag.Args())
+	// strict CI setups can treat any warning as a failed run. that has to be decided before the quiet log is
+	// flushed, a run that fails this way gets the whole log like any other failed run
+	if err == nil && opts.warningsAsErrors && warningCount() > 0 {
+		err = fmt.Errorf("%d warnings were logged and -warnings-as-errors was given", warningCount())
+	}
+	if quiet != nil {
+		log.SetOutput(logOutput)
+		quiet.flush(err != nil)
+	}
+	if err != nil {
+		// running out of -max-runtime isn't a failure, but the exit status tells schedulers it was cut short
+		var partial *partialError
+		if errors.As(err, &partial) {
+			notifier.notify("partial", err.Error())
+			log.Printf("Partial: %s", err.Error())
+			os.Exit(exitPartial)
+		}
+		// with -verbose-errors, show every layer of context that was wrapped around the root cause
+		if opts.verboseErrors {
+			for e := err; e != nil; e = errors.Unwrap(e) {
+				log.Printf("Error: (%T) %s", e, e.Error())
+			}
+		}
+		fatalf("Fatal: %s", err.Error())
+	}
+	notifier.notify("success", "Operation completed successfully")
+	if !opts.quietSuccess {
+		log.Println("Success: Operation completed successfully")
+	}
+}
+
+// run does the actual import. every error it returns is wrapped with the phase it happened in
+// (setup, parse, export, merge, import or report) so failures can be traced back
+func run(opts options, args []string) (err error) {
+	started := time.Now()
+	phases := newPhaseTimer(started)
+	// set up completion notifications before anything can fail
+	notifier.url = opts.webhookURL
+	notifier.on = opts.webhookOn
+	switch opts.webhookOn {
+	case webhookAlways, webhookFailure, webhookNever:
+	default:
+		return fmt.Errorf("setup: unknown -webhook-on %s", opts.webhookOn)
+	}
+	if opts.webhookTemplate != "" {
+		if err := notifier.loadTemplate(opts.webhookTemplate); err != nil {
+			return fmt.Errorf("setup: could not load webhook template: %w", err)
+		}
+	}
+	// -mode fail-fast is shorthand for every strict option, plus no retrying and no tolerated mirror failures
+	switch opts.mode {
+	case modeBestEffort:
+	case modeFailFast:
+		opts.skipOnParseErrors = true
+		opts.failOnEmpty = true
+	default:
+		return fmt.Errorf("setup: unknown -mode %s", opts.mode)
+	}
+	opts.schemaVersion = strings.TrimPrefix(opts.schemaVersion, "v")
+	if opts.schemaVersion != "" && opts.schemaVersion != "2" && opts.schemaVersion != "3" {
+		return fmt.Errorf("setup: unknown -schema-version %s", opts.schemaVersion)
+	}
+	switch opts.importOrder {
+	case orderTogether, orderHostsFirst, orderNetblocksFirst:
+	default:
+		return fmt.Errorf("setup: unknown -import-order %s", opts.importOrder)
+	}
+	// -confirm asks on the terminal, unattended runs have to say yes up front
+	if opts.confirm && !opts.yes && !isTerminal(os.Stdin) {
+		return errors.New("setup: -confirm needs a terminal to ask on, pass -yes to run without asking")
+	}
+	// every host a run touches can be tagged with its id, -run-id implies -tag-run-id
+	runID := opts.runID
+	if runID != "" {
+		if err := checkRunID(runID); err != nil {
+			return fmt.Errorf("setup: invalid -run-id: %w", err)
+		}
+	} else if opts.tagRunID {
+		id, err := newRunID(started)
+		if err != nil {
+			return fmt.Errorf("setup: could not generate a run id: %w", err)
+		}
+		runID = id
+	}
+	if runID != "" {
+		notifier.summary.RunID = runID
+		log.Printf("Info: Run id %s, hosts this run touches are tagged %s%s", runID, runTagPrefix, runID)
+	}
+	if opts.streamLists && opts.hostsOut == "" && opts.ipsOut == "" {
+		return errors.New("setup: -stream-lists needs -hosts-out or -ips-out")
+	}
+	// the streamed lists are written before any filtering, so they can't have what the filters would drop
+	if opts.streamLists {
+		if conflicts := streamListConflicts(opts); len(conflicts) > 0 {
+			return fmt.Errorf("setup: -stream-lists writes the lists before results are filtered, it can't be used with %s", strings.Join(conflicts, ", "))
+		}
+	}
+	opts.asnFormat = strings.ToLower(opts.asnFormat)
+	switch opts.asnFormat {
+	case asnFormatNumber, asnFormatPrefix:
+	default:
+		return fmt.Errorf("setup: unknown -asn-format %s", opts.asnFormat)
+	}
+	var excludedIPs map[string]bool
+	if opts.excludeIP != "" {
+		ips, err := parseExcludedIPs(opts.excludeIP)
+		if err != nil {
+			return fmt.Errorf("setup: invalid -exclude-ip: %w", err)
+		}
+		excludedIPs = ips
+	}
+	if opts.parseWorkers < 1 {
+		return errors.New("setup: -parse-workers must be at least 1")
+	}
+	if opts.synthPrefix != 0 && (opts.synthPrefix < minSynthesizedPrefix || opts.synthPrefix > 32) {
+		return fmt.Errorf("setup: -synthesize-netblocks must be a prefix length from %d to 32", minSynthesizedPrefix)
+	}
+	switch opts.addressFamily {
+	case familyIPv4, familyIPv6, familyBoth:
+	default:
+		return fmt.Errorf("setup: unknown -address-family %s", opts.addressFamily)
+	}
+	// the prefixes only mean something to the duplicate scan
+	if opts.skipDedupe && (opts.stripWWW || opts.stripPrefix != "") {
+		return errors.New("setup: -skip-dedupe can't be combined with -strip-www or -strip-prefix")
+	}
+	if _, ok := timelineUnits[opts.timeline]; opts.timeline != "" && !ok {
+		return fmt.Errorf("setup: unknown -timeline %s", opts.timeline)
+	}
+	// every summary style output goes through the one -report-format
+	reports, err := newReporter(opts.reportFormat)
+	if err != nil {
+		return fmt.Errorf("setup: -report-format: %w", err)
+	}
+	// json and csv reports are written as one document once the run is over, whichever way it ends
+	defer func() {
+		if ferr := reports.flush(); ferr != nil && err == nil {
+			err = fmt.Errorf("report: could not print the reports: %w", ferr)
+		}
+	}()
+	// hostnames are only stale when amass saw their IP, and a cut down run sees less than amass did
+	if opts.deleteMissing && opts.force && opts.limit > 0 {
+		return errors.New("setup: -delete-missing -force can't be combined with -limit, it would remove the hostnames of the results left out")
+	}
+	// -as-notes promises to leave hostnames and the host list alone
+	if opts.asNotes && (opts.forceHosts || opts.overwriteHostnames || opts.deleteMissing) {
+		return errors.New("setup: -as-notes can't be combined with -force-hosts, -overwrite-hostnames or -delete-missing")
+	}
+	// the -asn-lookup dataset is loaded up front, so a bad dataset fails before anything is parsed
+	var asns asnTable
+	if opts.asnLookup != "" {
+		if asns, err = loadASNTable(opts.asnLookup, fetchOptions{insecure: opts.insecureSSL, timeout: opts.timeout, proxy: opts.proxy}); err != nil {
+			return fmt.Errorf("setup: -asn-lookup dataset %s: %w", redactFilename(opts.asnLookup), err)
+		}
+	}
+	// the scope is loaded up front too, an engagement with a broken scope file shouldn't import anything
+	var engagementScope scope
+	if opts.scopeFile != "" {
+		if engagementScope, err = loadScope(opts.scopeFile); err != nil {
+			return fmt.Errorf("setup: could not load -scope-file: %w", err)
+		}
+	} else if opts.abortOnScope {
+		return errors.New("setup: -abort-on-scope-violation needs a -scope-file")
+	}
+	// load the post-parse transformation rules
+	var pipeline []transformer
+	if opts.rulesFile != "" {
+		if pipeline, err = loadRules(opts.rulesFile); err != nil {
+			return fmt.Errorf("setup: could not load rules: %w", err)
+		}
+	}
+	// -hostname-rewrite rules run after the rules file, in the order they were given
+	for _, expr := range opts.hostnameRewrites {
+		rule, err := parseRewrite(expr)
+		if err != nil {
+			return fmt.Errorf("setup: invalid -hostname-rewrite: %w", err)
+		}
+		pipeline = append(pipeline, rule)
+	}
+	// compile the hostname filters up front so a typo fails before anything is parsed
+	var includeRe, excludeRe *regexp.Regexp
+	if opts.includeRegex != "" {
+		if includeRe, err = regexp.Compile(opts.includeRegex); err != nil {
+			return fmt.Errorf("setup: invalid -hostname-include-regex: %w", err)
+		}
+	}
+	if opts.excludeRegex != "" {
+		if excludeRe, err = regexp.Compile(opts.excludeRegex); err != nil {
+			return fmt.Errorf("setup: invalid -hostname-exclude-regex: %w", err)
+		}
+	}
 	// check for required environment variables
 	lairURL := os.Getenv("LAIR_API_SERVER")
 	if lairURL == "" {
-		log.Fatal("Fatal: Missing LAIR_API_SERVER environment variable")
+		return errors.New("setup: missing LAIR_API_SERVER environment variable")
 	}
 	// use lair project ID from environment variable if present
 	lairPID := os.Getenv("LAIR_ID")
 
 	// read filename and project ID arguments
 	var filename string
-	switch len(flag.Args()) {
+	switch len(args) {
 	case 2:
-		lairPID = flag.Arg(0)
-		filename = flag.Arg(1)
+		lairPID = args[0]
+		filename = args[1]
 	case 1:
-		filename = flag.Arg(0)
+		filename = args[0]
 	default:
-		log.Fatal("Fatal: Missing required argument")
+		return errors.New("setup: missing required argument")
 	}
 	if lairPID == "" {
-		log.Fatal("Fatal: Missing LAIR_ID")
+		return errors.New("setup: missing LAIR_ID")
 	}
-	// validate given lair URL
-	u, err := url.Parse(lairURL)
+	notifier.summary.ProjectID = lairPID
+	// load the client certificate for servers that require mutual TLS
+	var cert *tls.Certificate
+	if opts.clientCert != "" || opts.clientKey != "" {
+		if cert, err = loadClientCert(opts.clientCert, opts.clientKey); err != nil {
+			return fmt.Errorf("setup: %w", err)
+		}
+	}
+	lairClient, err := newLairClient(lairURL, opts.insecureSSL, cert, opts.requestTimeout)
 	if err != nil {
-		log.Fatalf("Fatal: Error parsing LAIR_API_SERVER URL. Error %s", err.Error())
+		return fmt.Errorf("setup: LAIR_API_SERVER: %w", err)
 	}
-	// validate given credentials
-	if u.User == nil {
-		log.Fatal("Fatal: Missing username and/or password")
+	lairClient = withRetries(lairClient, opts.requestTimeout, opts.requestRetries)
+	// set up clients for the servers the project is mirrored to
+	mirrors := []lairAPI{}
+	for _, m := range opts.mirrors {
+		c, err := newLairClient(m, opts.insecureSSL, cert, opts.requestTimeout)
+		if err != nil {
+			return fmt.Errorf("setup: mirror %s: %w", redactURL(m), err)
+		}
+		mirrors = append(mirrors, withRetries(c, opts.requestTimeout, opts.requestRetries))
 	}
-	user := u.User.Username()
-	pass, _ := u.User.Password()
-	if user == "" || pass == "" {
-		log.Fatal("Fatal: Missing username and/or password")
+	// -output-lair-url links are built from the API server, the template is checked before anything is parsed
+	var linkTmpl *template.Template
+	var linkBase string
+	if opts.outputLairURL {
+		if linkTmpl, err = template.New("link").Parse(opts.linkTemplate); err != nil {
+			return fmt.Errorf("setup: invalid -lair-url-template: %w", err)
+		}
+		if linkBase, err = linkServer(lairURL); err != nil {
+			return fmt.Errorf("setup: LAIR_API_SERVER: %w", err)
+		}
 	}
-	// create lair API client
-	lairClient, err := client.New(&client.COptions{
-		User:               user,
-		Password:           pass,
-		Host:               u.Host,
-		Scheme:             u.Scheme,
-		InsecureSkipVerify: *insecureSSL,
+	// the client only offers export and import, so the pre-flight check is an export that is thrown away
+	if opts.checkAuth {
+		if _, err := lairClient.ExportProject(lairPID); err != nil {
+			return fmt.Errorf("setup: -check-auth: could not access project %s on %s, check the credentials and project id: %w", lairPID, redactURL(lairURL), err)
+		}
+		log.Printf("Info: Credentials and access to project %s checked", lairPID)
+	}
+	phases.mark("setup")
+	// read file (or URL) into "data" variable
+	data, err := readInput(filename, fetchOptions{
+		insecure: opts.insecureSSL,
+		timeout:  opts.timeout,
+		proxy:    opts.proxy,
+		encoding: opts.inputEncoding,
 	})
 	if err != nil {
-		log.Fatalf("Fatal: Error setting up client: Error %s", err.Error())
+		return fmt.Errorf("parse: could not open file: %w", err)
 	}
-	// read file into "data" variable
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		log.Fatalf("Fatal: Could not open file. Error %s", err.Error())
+	// a checkpoint only applies to the results file it was made for
+	var resume *checkpoint
+	if opts.resume != "" {
+		resume = loadCheckpoint(opts.resume, lairPID, inputDigest(data))
 	}
+	phases.mark("read")
 	// parse tags given as arguments
 	hostTags := []string{}
-	if *tags != "" {
-		hostTags = strings.Split(*tags, ",")
+	if opts.tags != "" {
+		for _, t := range strings.Split(opts.tags, ",") {
+			hostTags = append(hostTags, expandTag(t))
+		}
 	}
 	// create a map (aka hashtable) of with a string and bool "column"
 	tagSet := map[string]bool{}
 
+	// pick the parser for the input format
+	inputFormat := opts.format
+	if inputFormat == "auto" {
+		inputFormat = detectFormat(data)
+		if opts.verbose {
+			fmt.Printf("detected %s input format\n", inputFormat)
+		}
+	}
+	// closing done stops the parser, when the run ends or -max-runtime cuts parsing short
+	done := make(chan struct{})
+	stopParsing := func() {
+		if done != nil {
+			close(done)
+			done = nil
+		}
+	}
+	defer stopParsing()
+	var parse parser
+	switch inputFormat {
+	case "json":
+		parse = parseJsonLines
+		if opts.schemaVersion != "" {
+			parse = schemaParser(opts.schemaVersion)
+		}
+	case "text":
+		parse = parseTextLines
+	case "db":
+		parse = parseDBLines
+	default:
+		return fmt.Errorf("parse: unknown input format %s", inputFormat)
+	}
+	// decoding is what takes the time on large files, -parse-workers spreads it over several cores
+	// db rows refer to each other across the whole file, so a chunk of it can't be decoded on its own
+	if opts.parseWorkers > 1 && inputFormat != "db" {
+		parse = parallelParser(parse, opts.parseWorkers, done)
+	}
+	// -strict-json stops on fields an amass upgrade added that nothing here maps yet
+	if opts.strictJSON && inputFormat == "json" {
+		if unknown := unknownFields(data); len(unknown) > 0 {
+			return fmt.Errorf("parse: -strict-json: the results have fields drone-amass doesn't handle: %s", describeFields(unknown))
+		}
+	}
 	// create empty array of results
 	var aResults []amassResult
-	// call the function to parse the raw jsonlines file contents from amass into an array of json strings "aResults"
-	parseJsonLines(data, func(result amassResult) {
-		if *verboseOut {
-			fmt.Printf("got amass json result %v\n", result)
+	// parse the raw file contents from amass in the background and collect them into an array of results "aResults"
+	results, errc := streamResults(data, parse, done)
+	// with -max-runtime, stop parsing when the budget runs out and import whatever was parsed so far
+	var budget <-chan time.Time
+	partial := ""
+	if opts.maxRuntime > 0 {
+		timer := time.NewTimer(time.Until(started.Add(opts.maxRuntime)))
+		defer timer.Stop()
+		budget = timer.C
+	}
+	// with -stream-lists the lists are written as the results come in, rather than sorted once everything is parsed
+	streams := []*listWriter{}
+	if opts.streamLists {
+		for _, out := range []struct{ filename, key string }{{opts.hostsOut, "hostname"}, {opts.ipsOut, "ip"}} {
+			if out.filename == "" {
+				continue
+			}
+			l, err := newListWriter(out.filename, out.key)
+			if err != nil {
+				return fmt.Errorf("report: could not create %s: %w", out.filename, err)
+			}
+			defer l.close()
+			streams = append(streams, l)
 		}
-		aResults = append(aResults, result)
-	})
+	}
+parsing:
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				break parsing
+			}
+			if opts.verbose {
+				fmt.Printf("got amass %s result %v\n", inputFormat, result)
+			}
+			if len(streams) > 0 {
+				cleaned := cleanForList(result, opts)
+				for _, l := range streams {
+					if err := l.addResult(cleaned); err != nil {
+						return fmt.Errorf("report: could not write %s: %w", l.f.Name(), err)
+					}
+				}
+			}
+			aResults = append(aResults, result)
+		case <-budget:
+			partial = fmt.Sprintf("max runtime reached after parsing %d results", len(aResults))
+			warnf("%s, importing what was parsed", partial)
+			stopParsing()
+			break parsing
+		}
+	}
+	for _, l := range streams {
+		name := l.f.Name()
+		if err := l.close(); err != nil {
+			return fmt.Errorf("report: could not write %s: %w", name, err)
+		}
+	}
+	badLines := 0
+	if partial == "" {
+		if err := <-errc; err != nil {
+			var bad lineErrors
+			if !errors.As(err, &bad) {
+				return fmt.Errorf("parse: %s: %w", filename, err)
+			}
+			for _, e := range bad {
+				warnf("Skipped unparseable result in %s, %s", filename, e)
+			}
+			badLines = len(bad)
+			// strict teams would rather import nothing than a partial dataset
+			if opts.skipOnParseErrors {
+				return fmt.Errorf("parse: %s: %w, not importing a partial dataset", filename, err)
+			}
+		}
+	}
+	// a hostname on a line that didn't parse, or wasn't parsed in time, would look stale to -delete-missing
+	if opts.deleteMissing && opts.force {
+		if partial != "" {
+			return fmt.Errorf("parse: %s, not removing hostnames with -delete-missing from a partial parse", partial)
+		}
+		if badLines > 0 {
+			return fmt.Errorf("parse: %d lines of %s could not be parsed, not removing hostnames with -delete-missing", badLines, filename)
+		}
+	}
+	// an empty file would otherwise look like an import that worked
+	parsedCount := len(aResults)
+	if parsedCount == 0 && partial == "" {
+		if opts.failOnEmpty {
+			return fmt.Errorf("parse: no results found in %s", filename)
+		}
+		warnf("No results found in %s", filename)
+	}
+	// the csv is everything amass found, so it is written before anything is filtered
+	if opts.outputCSV != "" {
+		if err := writeCSV(opts.outputCSV, aResults); err != nil {
+			return fmt.Errorf("report: could not write csv: %w", err)
+		}
+	}
+	// stray tabs and newlines from amass render badly in lair
+	if !opts.noNormalize {
+		if n := normalizeWhitespace(aResults); n > 0 && opts.verbose {
+			fmt.Printf("normalized whitespace in %d results\n", n)
+		}
+	}
+	// guard against bad data, a result with thousands of addresses makes every loop below explode
+	if opts.maxAddresses > 0 {
+		if capped := capAddresses(aResults, opts.maxAddresses); len(capped) > 0 {
+			warnf("%d results had more than %d addresses, only the first %d of each were kept", len(capped), opts.maxAddresses, opts.maxAddresses)
+			if opts.verbose {
+				for _, name := range capped {
+					fmt.Printf("capped addresses of %s\n", name)
+				}
+			}
+		}
+	}
+	// some amass-adjacent tools emit ip:port, which never matches a host IP
+	if opts.stripPort {
+		stripPorts(aResults)
+	}
+	// and some report the name with the port they found it on, which would import as a broken hostname
+	if opts.stripHostnamePorts {
+		if n := stripNamePorts(aResults); n > 0 && opts.verbose {
+			fmt.Printf("stripped ports from %d result names\n", n)
+		}
+	}
+	// canonicalize netblock notation so netblocks don't get duplicated over how amass wrote them
+	// everything the dedupe steps fold together, for -dedupe-report
+	collapsed := []collapse{}
+	if opts.normalizeCIDR {
+		collapsed = append(collapsed, normalizeCIDRs(aResults)...)
+	}
+	// some sources give a CIDR without its ASN, fill those in so the netblocks aren't created blank
+	if asns != nil {
+		if n := enrichASNs(aResults, asns); n > 0 {
+			log.Printf("Info: Filled in the ASN of %d addresses from %s", n, redactFilename(opts.asnLookup))
+		}
+	}
+	// -delete-missing compares against everything amass reported, not just what is left after the filters below
+	var unfiltered []amassResult
+	if opts.deleteMissing {
+		unfiltered = append(unfiltered, aResults...)
+	}
+	// only keep results found since the last successful run
+	if opts.newerThanFile != "" {
+		since, err := readMarker(opts.newerThanFile)
+		if err != nil {
+			return fmt.Errorf("parse: could not read marker file: %w", err)
+		}
+		parsed := len(aResults)
+		aResults = filterNewerThan(aResults, since)
+		if opts.verbose {
+			fmt.Printf("skipped %d of %d results older than %s\n", parsed-len(aResults), parsed, since.Format(time.RFC3339))
+		}
+	}
+	// run the results through the transformation rules before merging
+	if len(pipeline) > 0 {
+		parsed := len(aResults)
+		aResults = applyTransforms(aResults, pipeline)
+		if opts.verbose {
+			fmt.Printf("rules dropped %d of %d results\n", parsed-len(aResults), parsed)
+		}
+	}
+	// drop noisy subdomains regardless of domain scope
+	if opts.dropSuffix != "" {
+		parsed := len(aResults)
+		aResults = dropSuffixes(aResults, strings.Split(opts.dropSuffix, ","))
+		if dropped := parsed - len(aResults); dropped > 0 {
+			log.Printf("Info: Dropped %d results matching -drop-suffix", dropped)
+		}
+	}
+	// names parked on a sinkhole or a registrar's holding page are noise, whatever else they resolve to
+	if excludedIPs != nil {
+		var dropped map[string]int
+		aResults, dropped = dropResolvedTo(aResults, excludedIPs)
+		ips := []string{}
+		for ip := range dropped {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			log.Printf("Info: Dropped %d results resolving to %s, given in -exclude-ip", dropped[ip], ip)
+		}
+	}
+	// naming convention based scoping
+	if includeRe != nil || excludeRe != nil {
+		parsed := len(aResults)
+		aResults = filterHostnames(aResults, includeRe, excludeRe)
+		if dropped := parsed - len(aResults); dropped > 0 {
+			log.Printf("Info: Dropped %d results with -hostname-include-regex/-hostname-exclude-regex", dropped)
+		}
+	}
+	if opts.minNameLength > 0 {
+		parsed := len(aResults)
+		aResults = dropShortNames(aResults, opts.minNameLength)
+		if dropped := parsed - len(aResults); dropped > 0 {
+			log.Printf("Info: Dropped %d results with names shorter than -min-hostname-length %d", dropped, opts.minNameLength)
+		}
+	}
+	// keep internal addresses from misconfigured DNS out of external engagements
+	if opts.ignorePrivateIPs {
+		var skipped int
+		aResults, skipped = dropPrivateIPs(aResults)
+		if skipped > 0 {
+			log.Printf("Info: Skipped %d private or reserved addresses", skipped)
+		}
+	}
+	// engagements scoped to one address family
+	if opts.addressFamily != familyBoth {
+		var skipped int
+		aResults, skipped = dropAddressFamily(aResults, opts.addressFamily)
+		if skipped > 0 {
+			log.Printf("Info: Skipped %d addresses outside -address-family %s", skipped, opts.addressFamily)
+		}
+	}
+	// results outside the -scope-file are dropped, or with -abort-on-scope-violation stop the run
+	if opts.scopeFile != "" {
+		var violations []unmatchedResult
+		aResults, violations = outOfScope(aResults, engagementScope)
+		if len(violations) > 0 && opts.abortOnScope {
+			if err := writeUnmatched(opts.scopeReport, violations); err != nil {
+				return fmt.Errorf("report: could not write scope violations: %w", err)
+			}
+			return fmt.Errorf("parse: %d results are out of scope and -abort-on-scope-violation was given, they are listed in %s", len(violations), opts.scopeReport)
+		}
+		if len(violations) > 0 {
+			log.Printf("Info: Dropped %d results outside -scope-file", len(violations))
+		}
+	}
+	// strict workflows treat wildcard DNS as a sign that the scope needs review
+	if opts.failOnWildcard {
+		if names := wildcardNames(aResults); len(names) > 0 {
+			log.Println("Error: The following results have wildcard names")
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return fmt.Errorf("parse: found %d wildcard results and -fail-on-wildcard was given", len(names))
+		}
+	}
+	if opts.mergeMAC {
+		normalizeMACs(aResults)
+	}
+	// collapse identical results from overlapping sources so the merge doesn't do the same work twice
+	var prefixes []string
+	if opts.stripWWW {
+		prefixes = append(prefixes, "www.")
+	}
+	if opts.stripPrefix != "" {
+		prefixes = append(prefixes, strings.Split(opts.stripPrefix, ",")...)
+	}
+	// -skip-dedupe trusts the input to be unique already, on huge files the scan is a noticeable part of the run
+	if !opts.skipDedupe {
+		var duplicates []collapse
+		aResults, duplicates = dedupeResults(aResults, prefixes)
+		if len(duplicates) > 0 {
+			log.Printf("Info: Collapsed %d duplicate results", len(duplicates))
+		}
+		collapsed = append(collapsed, duplicates...)
+	}
+	// certificate transparency logs repeat names in ways the general dedupe doesn't recognize
+	if opts.ctDedup {
+		var artifacts []collapse
+		aResults, artifacts = ctDedupe(aResults)
+		if len(artifacts) > 0 {
+			log.Printf("Info: Collapsed %d certificate transparency duplicates", len(artifacts))
+		}
+		collapsed = append(collapsed, artifacts...)
+	}
+	// CNAME chains name the same addresses several times over, only the end of the chain is imported
+	if opts.collapseCNAMEs {
+		var aliases []collapse
+		aResults, aliases = collapseCNAMEs(aResults)
+		if len(aliases) > 0 {
+			log.Printf("Info: Collapsed %d CNAME aliases into the end of their chains", len(aliases))
+		}
+		collapsed = append(collapsed, aliases...)
+	}
+	if opts.dedupeReport != "" {
+		if err := writeDedupeReport(opts.dedupeReport, collapsed); err != nil {
+			return fmt.Errorf("report: could not write dedupe report: %w", err)
+		}
+	}
+	// -limit takes the first results by name, so the same file always gives the same partial import
+	if opts.limit > 0 && len(aResults) > opts.limit {
+		sort.SliceStable(aResults, func(i, j int) bool {
+			return aResults[i].Name < aResults[j].Name
+		})
+		log.Printf("Info: Limited to the first %d of %d results by name", opts.limit, len(aResults))
+		aResults = aResults[:opts.limit]
+	}
+	// pick one source per hostname so provenance doesn't depend on the order sources answered in
+	if opts.sourcePriority != "" {
+		resolveSources(aResults, strings.Split(opts.sourcePriority, ","))
+	}
+	if parsedCount > 0 && len(aResults) == 0 {
+		warnf("All %d results in %s were filtered out", parsedCount, filename)
+	}
+	notifier.summary.Results = len(aResults)
+	phases.mark("parse")
+	if opts.showScope {
+		if err := reports.write(scopeReport(summarizeDomains(aResults))); err != nil {
+			return fmt.Errorf("report: could not print scope summary: %w", err)
+		}
+	}
+	if opts.summaryByASN {
+		if err := reports.write(asnReport(summarizeASNs(aResults))); err != nil {
+			return fmt.Errorf("report: could not print ASN summary: %w", err)
+		}
+	}
+	if opts.timeline != "" {
+		if err := reports.write(timelineReport(summarizeTimeline(aResults, opts.timeline))); err != nil {
+			return fmt.Errorf("report: could not print timeline: %w", err)
+		}
+	}
+	if opts.hostsOut != "" && !opts.streamLists {
+		if err := writeLines(opts.hostsOut, "hostname", hostnameList(aResults)); err != nil {
+			return fmt.Errorf("report: could not write -hosts-out: %w", err)
+		}
+	}
+	if opts.ipsOut != "" && !opts.streamLists {
+		if err := writeLines(opts.ipsOut, "ip", ipList(aResults)); err != nil {
+			return fmt.Errorf("report: could not write -ips-out: %w", err)
+		}
+	}
 
 	// define results as slice of amassResults
 	type Results []amassResult
@@ -175,13 +1762,17 @@ func main() {
 	// grab lair project from lair API and store in variable
 	exproject, err := lairClient.ExportProject(lairPID)
 	if err != nil {
-		log.Fatalf("Fatal: Unable to export project. Error %s", err.Error())
-		if *verboseOut {
-			fmt.Printf("project: %v", exproject)
-
+		return fmt.Errorf("export: unable to export project %s: %w", lairPID, err)
+	}
+	// keep a restore point before anything is merged in, a failed backup stops the run
+	if opts.projectBackup != "" {
+		name, err := backupProject(opts.projectBackup, lairPID, exproject, started)
+		if err != nil {
+			return fmt.Errorf("backup: could not back up project %s: %w", lairPID, err)
 		}
+		log.Printf("Info: Backed up project %s to %s", lairPID, name)
 	}
-
+	phases.mark("export")
 	// create empty project variable to store merged content in later
 	project := &lair.Project{
 		ID:   lairPID,
@@ -190,34 +1781,197 @@ func main() {
 			Tool: tool,
 		}},
 	}
+	if runID != "" {
+		project.Commands[0].Command = "run " + runID
+	}
+	// ports found with -strip-port, keyed by IP, to be imported as services with -import-ports
+	hostPorts := map[string][]int{}
+	// tags for individual hosts, on top of the -tags that every host gets
+	hostExtraTags := map[string][]string{}
+	// -delete-missing works out which hostnames went stale before the merge adds anything. the preview is
+	// always printed, the hostnames are only removed when -force confirms it
+	var stale map[string][]string
+	if opts.deleteMissing {
+		stale = staleHostnames(exproject.Hosts, unfiltered)
+		if err := reports.write(staleReport(stale)); err != nil {
+			return fmt.Errorf("report: could not print stale hostnames: %w", err)
+		}
+		if !opts.force {
+			log.Println("Info: -delete-missing preview only, nothing will be removed. Re-run with -force to remove the stale hostnames")
+			stale = nil
+		}
+	}
+	// -verbose-diff-hosts and -report-diff-json compare against the hostnames every host had before the merge
+	var hostnamesBefore map[string][]string
+	if opts.verboseDiffHosts || opts.reportDiffJSON != "" {
+		hostnamesBefore = map[string][]string{}
+		for _, h := range exproject.Hosts {
+			hostnamesBefore[h.IPv4] = append([]string{}, h.Hostnames...)
+		}
+	}
+	// -hostname-limit-total caps how many hostnames this run adds across all hosts. results are
+	// merged in name order so the same input always keeps the same hostnames
+	hostnamesAdded, hostnamesSkipped := 0, 0
+	allowHostname := func() bool {
+		if opts.hostnameLimit > 0 && hostnamesAdded >= opts.hostnameLimit {
+			hostnamesSkipped++
+			return false
+		}
+		hostnamesAdded++
+		return true
+	}
+	if opts.hostnameLimit > 0 {
+		sort.SliceStable(aResults, func(i, j int) bool {
+			return aResults[i].Name < aResults[j].Name
+		})
+	}
+	// the hostnames lair had for the hosts -overwrite-hostnames already replaced them on, keyed by IP
+	replaced := map[string][]string{}
+	// names collected with -as-notes, keyed by IP
+	hostNotes := map[string][]string{}
+	// the sources that contributed each host's hostnames, keyed by IP, for -annotate-sources
+	hostSources := map[string][]string{}
+	// the raw input lines of the results that matched each host, keyed by IP, for -archive-raw
+	hostRaw := map[string][]string{}
+	// existing hosts by hostname for -match-by-hostname, and the addresses found for them that way
+	hostsByName := map[string]int{}
+	if opts.matchByHostname {
+		for i, h := range exproject.Hosts {
+			for _, name := range h.Hostnames {
+				if _, ok := hostsByName[strings.ToLower(name)]; !ok {
+					hostsByName[strings.ToLower(name)] = i
+				}
+			}
+		}
+	}
+	hostAddresses := map[string][]string{}
+	// the MAC addresses results reported for each host, keyed by IP, for -merge-mac
+	hostMACs := map[string][]string{}
+	if opts.rawAddresses {
+		printAddressMatches(aResults, exproject.Hosts, opts.keepWildcards)
+	}
+	// the IPs lair already has a host for, anything else a result reports is a candidate for -force-hosts
+	existingIPs := map[string]bool{}
+	for _, h := range exproject.Hosts {
+		existingIPs[h.IPv4] = true
+	}
 	// iterate through results for lair Hosts, append IP addresss matches to exproject for merging later
 	for _, result := range aResults {
 		found := false
-		if !strings.Contains(result.Name, "*") {
+		wildcard := strings.Contains(result.Name, "*")
+		if !wildcard || opts.keepWildcards {
+			// the hosts this result's name went to, with -coalesce-addresses a host gets it once however many
+			// of the result's addresses point at it
+			attached := map[int]bool{}
 			for i := range exproject.Hosts {
 				h := exproject.Hosts[i]
 				for _, address := range result.Addresses {
-					if *verboseOut {
+					if opts.verbose {
 						fmt.Printf("%s has IP address: %s\n", result.Name, address.IP)
 					}
 					if address.IP == h.IPv4 {
-						exproject.Hosts[i].Hostnames = append(exproject.Hosts[i].Hostnames, result.Name)
+						if opts.importPorts && address.Port != 0 {
+							hostPorts[h.IPv4] = append(hostPorts[h.IPv4], address.Port)
+						}
+						if opts.archiveRaw && result.Raw != "" {
+							hostRaw[h.IPv4] = appendUnique(hostRaw[h.IPv4], result.Raw)
+						}
+						if opts.mergeMAC && address.MAC != "" {
+							hostMACs[h.IPv4] = appendUnique(hostMACs[h.IPv4], address.MAC)
+						}
+						if !opts.coalesceAddresses || !attached[i] {
+							attached[i] = true
+							// a name the host already has isn't added again, and doesn't count against the limit
+							known := contains(exproject.Hosts[i].Hostnames, result.Name) || contains(replaced[h.IPv4], result.Name)
+							allowed := known || allowHostname()
+							if allowed && opts.annotateSources {
+								hostSources[h.IPv4] = appendUnique(hostSources[h.IPv4], result.Sources...)
+							}
+							if !allowed {
+								// over the limit, the host counts as matched but keeps its hostnames
+							} else if opts.asNotes {
+								// review mode, the name goes into a note and the hostnames stay as they were
+								hostNotes[h.IPv4] = appendUnique(hostNotes[h.IPv4], result.Name)
+							} else if opts.overwriteHostnames {
+								// the drone is authoritative, the first match throws away what the host had before
+								if _, ok := replaced[h.IPv4]; !ok {
+									replaced[h.IPv4] = exproject.Hosts[i].Hostnames
+									exproject.Hosts[i].Hostnames = []string{}
+								}
+								exproject.Hosts[i].Hostnames = appendUnique(exproject.Hosts[i].Hostnames, result.Name)
+							} else {
+								exproject.Hosts[i].Hostnames = appendUnique(exproject.Hosts[i].Hostnames, result.Name)
+							}
+						}
 						exproject.Hosts[i].LastModifiedBy = tool
+						if wildcard && opts.tagWildcardHosts {
+							hostExtraTags[h.IPv4] = appendUnique(hostExtraTags[h.IPv4], wildcardTag)
+						}
+						if opts.tagCIDR && address.Cidr != "" {
+							hostExtraTags[h.IPv4] = appendUnique(hostExtraTags[h.IPv4], cidrTag(address.Cidr))
+						}
+						if tag := orgTag(address.Desc); opts.tagOrg && tag != "" {
+							hostExtraTags[h.IPv4] = appendUnique(hostExtraTags[h.IPv4], tag)
+						}
 						found = true
 						if _, ok := tagSet[h.IPv4]; !ok {
 							tagSet[h.IPv4] = true
 							exproject.Hosts[i].Tags = append(exproject.Hosts[i].Tags, hostTags...)
 						}
 					}
-					if !found {
-						hNotFound[address.IP] = append(hNotFound[address.IP], result)
-					}
 				}
 			}
+			// addresses no host has, once each however many hosts were looked at
+			unmatched := map[string]bool{}
+			for _, address := range result.Addresses {
+				if !existingIPs[address.IP] && !unmatched[address.IP] {
+					unmatched[address.IP] = true
+					hNotFound[address.IP] = append(hNotFound[address.IP], result)
+				}
+			}
+		}
+		// IP matches win, but with -match-by-hostname a result that matched no IP can still belong to the host
+		// that already has its name, e.g. one that moved. its new addresses are noted on that host instead of
+		// being reported as unmatched or forced in as new hosts
+		if i, ok := hostsByName[strings.ToLower(result.Name)]; ok && !found && !wildcard && opts.matchByHostname {
+			h := exproject.Hosts[i]
+			for _, address := range result.Addresses {
+				hostAddresses[h.IPv4] = appendUnique(hostAddresses[h.IPv4], fmt.Sprintf("%s resolved to %s", result.Name, address.IP))
+				hNotFound[address.IP] = withoutName(hNotFound[address.IP], result.Name)
+				if len(hNotFound[address.IP]) == 0 {
+					delete(hNotFound, address.IP)
+				}
+			}
+			exproject.Hosts[i].LastModifiedBy = tool
+			if _, ok := tagSet[h.IPv4]; !ok {
+				tagSet[h.IPv4] = true
+				exproject.Hosts[i].Tags = append(exproject.Hosts[i].Tags, hostTags...)
+			}
 		}
 	}
+	// drop the stale hostnames confirmed with -force. that only shapes what is sent, lair adds the hostnames
+	// of an import to the ones its hosts have, so the lair api-server still keeps them
+	for i, h := range exproject.Hosts {
+		if remove, ok := stale[h.IPv4]; ok {
+			exproject.Hosts[i].Hostnames = removeHostnames(h.Hostnames, remove)
+			exproject.Hosts[i].LastModifiedBy = tool
+		}
+	}
+	if len(stale) > 0 {
+		log.Println("Info: -delete-missing left the stale hostnames out of the import, the lair api-server merges hostnames and keeps them")
+	}
+	if len(replaced) > 0 {
+		log.Println("Info: -overwrite-hostnames sent hosts with only the hostnames amass found, the lair api-server merges hostnames and keeps the old ones")
+	}
 	// append results to hosts
 	for _, h := range exproject.Hosts {
+		// hosts added by older versions of the drone were imported without it
+		if h.LongIPv4Addr == 0 {
+			h.LongIPv4Addr = longIPv4(h.IPv4)
+		}
+		if opts.mergeMAC {
+			h.MAC = mergeMAC(h.IPv4, h.MAC, hostMACs[h.IPv4])
+		}
 		project.Hosts = append(project.Hosts, lair.Host{
 			IPv4:           h.IPv4,
 			LongIPv4Addr:   h.LongIPv4Addr,
@@ -227,86 +1981,340 @@ func main() {
 			OS:             h.OS,
 			Status:         h.Status,
 			StatusMessage:  h.StatusMessage,
-			Tags:           hostTags,
+			Tags:           append(append([]string{}, hostTags...), hostExtraTags[h.IPv4]...),
 			Hostnames:      h.Hostnames,
+			Services:       portServices(hostPorts[h.IPv4]),
+			Notes:          hostNotesFor(hostNotes[h.IPv4], hostSources[h.IPv4], hostAddresses[h.IPv4], hostRaw[h.IPv4]),
 		})
 	}
+	// environment variables work like in -tags, e.g. "found by amass for $ENGAGEMENT_ID"
+	hostDescription := expandTag(opts.hostDescription)
+	// forced hosts amass reported no CIDR for, for -synthesize-netblocks
+	withoutCIDR := []string{}
 	// if forceHosts was specified, add all hosts that weren't previously in lair to the project along with their hostnames
-	if *forceHosts {
+	if opts.forceHosts {
 		fmt.Printf("force hosts was specified, adding all hosts from amass into lair project\n")
-		for ip, results := range hNotFound {
+		// walk the IPs in order so the result doesn't depend on map iteration
+		forcedIPs := []string{}
+		for ip := range hNotFound {
+			forcedIPs = append(forcedIPs, ip)
+		}
+		sort.Strings(forcedIPs)
+		for _, ip := range forcedIPs {
+			results := hNotFound[ip]
 			hostnames := []string{}
+			ports := []int{}
+			var tags, sources, raw, macs []string
+			hasCIDR := false
+			// the earliest timestamp of any result for the IP, for -annotate-first-seen
+			var firstSeen time.Time
 			for _, r := range results {
-				hostnames = append(hostnames, r.Name)
+				if t, ok := r.discovered(); ok && opts.annotateFirstSeen && (firstSeen.IsZero() || t.Before(firstSeen)) {
+					firstSeen = t
+				}
+				if opts.archiveRaw && r.Raw != "" {
+					raw = appendUnique(raw, r.Raw)
+				}
+				if allowHostname() {
+					hostnames = append(hostnames, r.Name)
+					if opts.annotateSources {
+						sources = appendUnique(sources, r.Sources...)
+					}
+				}
+				if opts.tagWildcardHosts && strings.Contains(r.Name, "*") {
+					tags = appendUnique(tags, wildcardTag)
+				}
+				for _, address := range r.Addresses {
+					if address.IP != ip {
+						continue
+					}
+					if opts.importPorts && address.Port != 0 {
+						ports = append(ports, address.Port)
+					}
+					if address.Cidr != "" {
+						hasCIDR = true
+					}
+					if opts.mergeMAC && address.MAC != "" {
+						macs = appendUnique(macs, address.MAC)
+					}
+					// tag the host with every ASN its address was announced from, so clusters show up in lair
+					if opts.groupByNetblock && address.Asn != "" {
+						tags = appendUnique(tags, "asn:"+address.Asn.String())
+					}
+					if opts.tagCIDR && address.Cidr != "" {
+						tags = appendUnique(tags, cidrTag(address.Cidr))
+					}
+					if tag := orgTag(address.Desc); opts.tagOrg && tag != "" {
+						tags = appendUnique(tags, tag)
+					}
+				}
+			}
+			// every hostname was over the limit, so there is nothing to force in
+			if len(hostnames) == 0 {
+				continue
+			}
+			if !hasCIDR {
+				withoutCIDR = append(withoutCIDR, ip)
+			}
+			if !firstSeen.IsZero() {
+				tags = appendUnique(tags, firstSeenTag(firstSeen))
 			}
 			project.Hosts = append(project.Hosts, lair.Host{
-				IPv4:      ip,
-				Hostnames: hostnames,
-				Status:    lair.StatusGrey,
+				IPv4:         ip,
+				LongIPv4Addr: longIPv4(ip),
+				MAC:          mergeMAC(ip, "", macs),
+				Hostnames:    hostnames,
+				Status:       lair.StatusGrey,
+				OS:           defaultOS(opts.defaultOS),
+				Services:     portServices(ports),
+				Tags:         tags,
+				Notes:        append(append(descriptionNote(hostDescription), sourcesNote(sources)...), rawNote(raw)...),
 			})
 		}
 	}
 
-	// iterate through results for lair Netblocks, matching CIDRs will get appended to exproject for merging later
+	// hosts with an unusual number of names are flagged, lair shows them to analysts as needing attention
+	if opts.hostnameThreshold > 0 {
+		for i, h := range project.Hosts {
+			if len(h.Hostnames) <= opts.hostnameThreshold {
+				continue
+			}
+			log.Printf("Info: %s has %d hostnames, flagging it for review", h.IPv4, len(h.Hostnames))
+			project.Hosts[i].IsFlagged = true
+			project.Hosts[i].Tags = appendUnique(project.Hosts[i].Tags, reviewTag)
+		}
+	}
+	// the run id goes on the hosts this run matched or created, hosts that were only carried forward keep their tags
+	if runID != "" {
+		for i, h := range project.Hosts {
+			if tagSet[h.IPv4] || !existingIPs[h.IPv4] {
+				project.Hosts[i].Tags = appendUnique(project.Hosts[i].Tags, runTagPrefix+runID)
+			}
+		}
+	}
+
+	if opts.verboseDiffHosts {
+		printHostDiffs(hostnamesBefore, project.Hosts, aResults)
+	}
+	if hostnamesSkipped > 0 {
+		warnf("Hostname limit of %d reached, skipped %d hostnames", opts.hostnameLimit, hostnamesSkipped)
+	}
+
+	// carry the existing netblocks forward untouched, like we do for hosts, so no netblock data is lost on import
+	existingNetblocks := map[string]bool{}
+	for _, n := range exproject.Netblocks {
+		existingNetblocks[n.CIDR] = true
+		if opts.normalizeCIDR {
+			existingNetblocks[canonicalCIDR(n.CIDR)] = true
+		}
+		project.Netblocks = append(project.Netblocks, n)
+	}
+	// iterate through results for lair Netblocks, CIDRs that aren't in the project yet are added once each.
 	// unlike with hosts, the default behavior here is to add netblocks even if they didn't exist before.
 	for _, result := range aResults {
-		for i := range exproject.Netblocks {
-			h := exproject.Netblocks[i]
-			for _, address := range result.Addresses {
-				if *verboseOut {
-					fmt.Printf("%s has Netblock %s\n", result.Name, address.Cidr)
-				}
-				if !*safeNetblocks {
-					asnString := strconv.Itoa(address.Asn)
-					project.Netblocks = append(project.Netblocks, lair.Netblock{
-						ASN:         asnString,
-						CIDR:        address.Cidr,
-						Description: address.Desc,
-					})
-				}
-				if address.Cidr != h.CIDR {
-					nNotFound[address.Cidr] = append(nNotFound[address.Cidr], result)
-				}
+		for _, address := range result.Addresses {
+			// text results may only carry an IP
+			if address.Cidr == "" {
+				continue
 			}
+			if opts.verbose {
+				fmt.Printf("%s has Netblock %s\n", result.Name, address.Cidr)
+			}
+			if existingNetblocks[address.Cidr] {
+				continue
+			}
+			if _, ok := nNotFound[address.Cidr]; !ok && !opts.safeNetblocks {
+				asnString := address.Asn.format(opts.asnFormat)
+				project.Netblocks = append(project.Netblocks, lair.Netblock{
+					ASN:         asnString,
+					CIDR:        address.Cidr,
+					Description: address.Desc,
+				})
+			}
+			nNotFound[address.Cidr] = append(nNotFound[address.Cidr], result)
+		}
+	}
+	// give forced hosts without a CIDR a netblock to be organized under, when enough of them share a range
+	if opts.synthPrefix > 0 && !opts.safeNetblocks {
+		for _, n := range synthesizeNetblocks(withoutCIDR, opts.synthPrefix, project.Netblocks) {
+			log.Printf("Info: Synthesized netblock %s, %s", n.CIDR, n.Description)
+			project.Netblocks = append(project.Netblocks, n)
+		}
+	}
+	// spread the tags analysts put on matched hosts to their neighbours, the ones lair already had count
+	if opts.propagateTags != "" {
+		if added := propagateTags(project.Hosts, exproject.Hosts, tagSet, project.Netblocks, strings.Split(opts.propagateTags, ",")); added > 0 {
+			log.Printf("Info: Propagated %d tags to hosts in the same netblock", added)
+		}
+	}
+
+	phases.mark("merge")
+	notifier.summary.Hosts = len(project.Hosts)
+	notifier.summary.Netblocks = len(project.Netblocks)
+	notifier.summary.HostsNotFound = len(hNotFound)
+	notifier.summary.NetblocksNotFound = len(nNotFound)
+
+	if opts.confirm && !opts.yes {
+		summary := fmt.Sprintf("About to import %d hosts (%d new) and %d netblocks (%d new) into project %s on %s",
+			len(project.Hosts), len(project.Hosts)-len(exproject.Hosts), len(project.Netblocks),
+			len(project.Netblocks)-len(exproject.Netblocks), project.ID, redactURL(lairURL))
+		if err := confirmImport(os.Stdin, os.Stdout, summary); err != nil {
+			return fmt.Errorf("import: %w", err)
 		}
 	}
 
 	// send the modified project to lair
-	res, err := lairClient.ImportProject(&client.DOptions{ForcePorts: *forcePorts}, project)
-	if err != nil {
-		log.Fatalf("Fatal: Unable to import project. Error %s", err)
+	var deadline time.Time
+	if opts.maxRuntime > 0 {
+		deadline = started.Add(opts.maxRuntime)
 	}
-	defer res.Body.Close()
-	droneRes := &client.Response{}
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Fatalf("Fatal: Error %s", err.Error())
+	imp := &importer{
+		client:   lairClient,
+		options:  &client.DOptions{ForcePorts: opts.forcePorts},
+		delay:    opts.importDelay,
+		deadline: deadline,
+		order:    opts.importOrder,
+		failFast: opts.mode == modeFailFast,
+		split:    opts.splitImport,
 	}
-	if err := json.Unmarshal(body, droneRes); err != nil {
-		log.Fatalf("Fatal: Could not unmarshal JSON. Error %s", err.Error())
+	// with -resume, whatever an interrupted run already got into lair isn't sent again
+	pending := project
+	if resume != nil {
+		pending = resume.skip(project)
+		if hosts, netblocks := len(project.Hosts)-len(pending.Hosts), len(project.Netblocks)-len(pending.Netblocks); hosts+netblocks > 0 {
+			log.Printf("Info: Resuming from %s, skipping %d hosts and %d netblocks that were already imported", opts.resume, hosts, netblocks)
+		}
+		imp.checkpoint = resume
 	}
-	if droneRes.Status == "Error" {
-		log.Fatalf("Fatal: Import failed. Error %s", droneRes.Message)
+	if err := imp.send(pending, opts.batchSize); err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	if resume != nil {
+		if err := resume.finish(); err != nil {
+			warnf("Could not remove checkpoint %s. Error %s", opts.resume, err.Error())
+		}
+	}
+	// what the servers warned about, -fail-on-api-warnings fails the run once everything is reported
+	apiWarnings := len(imp.warnings)
+	// mirrors get the same merged project, a failing mirror is reported but doesn't fail the run
+	for i, m := range mirrors {
+		mirror := &importer{
+			client:   m,
+			options:  imp.options,
+			delay:    opts.importDelay,
+			deadline: deadline,
+			order:    opts.importOrder,
+			failFast: imp.failFast,
+			split:    imp.split,
+		}
+		if err := mirror.send(project, opts.batchSize); err != nil {
+			if mirror.failFast {
+				return fmt.Errorf("import: mirror %s: %w", redactURL(opts.mirrors[i]), err)
+			}
+			warnf("Mirror import into %s failed. Error %s", redactURL(opts.mirrors[i]), err.Error())
+			continue
+		}
+		log.Printf("Info: Mirror import into %s succeeded", redactURL(opts.mirrors[i]))
+		apiWarnings += len(mirror.warnings)
+	}
+	phases.mark("import")
+	// the names of the results behind each IP or CIDR lair didn't have
+	names := func(notFound map[string]Results) map[string][]string {
+		byKey := map[string][]string{}
+		for k, results := range notFound {
+			byKey[k] = []string{}
+			for _, r := range results {
+				byKey[k] = appendUnique(byKey[k], r.Name)
+			}
+		}
+		return byKey
 	}
 	if len(hNotFound) > 0 {
-		if *forceHosts {
+		title := "Hosts not in lair"
+		if opts.forceHosts {
 			log.Println("Info: The following hosts had hostnames and were forced to import into lair")
+			title = "Forced hosts"
 		} else {
-			log.Println("Info: The following hosts had hostnames but could not be imported because they either had wildcard hostnames or do not exist in lair")
+			warnf("The following hosts had hostnames but could not be imported because they either had wildcard hostnames or do not exist in lair")
+		}
+		if err := reports.write(notFoundReport("hostsNotFound", title, "ip", names(hNotFound))); err != nil {
+			return fmt.Errorf("report: could not print the hosts not found: %w", err)
 		}
-	}
-	for k := range hNotFound {
-		fmt.Println(k)
 	}
 	if len(nNotFound) > 0 {
-		if *safeNetblocks {
+		title := "Added netblocks"
+		if opts.safeNetblocks {
 			log.Println("Info: The following netblocks were not imported into lair because they were not present before import")
+			title = "Netblocks not in lair"
 		} else {
 			log.Println("Info: The following netblocks were not present in the project, and were added")
 		}
+		if err := reports.write(notFoundReport("netblocksNotFound", title, "cidr", names(nNotFound))); err != nil {
+			return fmt.Errorf("report: could not print the netblocks not found: %w", err)
+		}
+	}
+	// export the results that didn't match an existing host so analysts can triage them
+	if opts.reportUnmatched != "" {
+		if err := writeUnmatched(opts.reportUnmatched, findUnmatched(aResults, exproject.Hosts, opts.keepWildcards)); err != nil {
+			return fmt.Errorf("report: could not write unmatched results: %w", err)
+		}
+	}
+	// list exactly which hosts and netblocks this import created
+	// new hosts only get their id on import, so the links come from a fresh export
+	if opts.outputLairURL {
+		changed := map[string]bool{}
+		for _, h := range project.Hosts {
+			if tagSet[h.IPv4] || !existingIPs[h.IPv4] {
+				changed[h.IPv4] = true
+			}
+		}
+		if after, err := lairClient.ExportProject(lairPID); err != nil {
+			warnf("Could not export project %s for the lair links. Error %s", lairPID, err.Error())
+		} else {
+			log.Printf("Info: Lair links for the %d created or updated hosts", len(changed))
+			printed, err := printHostLinks(linkTmpl, linkBase, lairPID, after.Hosts, changed)
+			if err != nil {
+				warnf("Could not render a lair link. Error %s", err.Error())
+			} else if printed < len(changed) {
+				warnf("%d of the hosts weren't in the project when it was exported again, there are no links for them", len(changed)-printed)
+			}
+		}
 	}
-	for k := range nNotFound {
-		fmt.Println(k)
+	if opts.reportDiffJSON != "" {
+		candidateHosts := []string{}
+		for ip := range hNotFound {
+			candidateHosts = append(candidateHosts, ip)
+		}
+		candidateNetblocks := []string{}
+		for cidr := range nNotFound {
+			candidateNetblocks = append(candidateNetblocks, cidr)
+		}
+		changes := findChanges(lairPID, hostnamesBefore, &exproject, project, candidateHosts, candidateNetblocks)
+		if err := writeChangeReport(opts.reportDiffJSON, changes); err != nil {
+			return fmt.Errorf("report: could not write -report-diff-json: %w", err)
+		}
+	}
+	if opts.onlyNew {
+		if err := reports.write(newAssetsReport(findNewAssets(exproject.Hosts, exproject.Netblocks, project))); err != nil {
+			return fmt.Errorf("report: could not print new assets: %w", err)
+		}
+	}
+	// where the time went, for diagnosing slow imports of large datasets
+	if opts.verbose {
+		phases.print(len(project.Hosts), len(project.Netblocks))
+	}
+	if opts.failOnAPIWarnings && apiWarnings > 0 {
+		return fmt.Errorf("import: lair returned %d warnings for the import and -fail-on-api-warnings was given", apiWarnings)
+	}
+	if partial != "" {
+		return &partialError{reason: partial}
+	}
+	// the import went through, move the incremental marker forward. this comes last so a run that fails,
+	// including with -warnings-as-errors once run returns, leaves the marker for the next run to retry from
+	if opts.newerThanFile != "" && !(opts.warningsAsErrors && warningCount() > 0) {
+		if err := writeMarker(opts.newerThanFile, started); err != nil {
+			return fmt.Errorf("report: could not update marker file: %w", err)
+		}
 	}
-	log.Println("Success: Operation completed successfully")
+	return nil
 }
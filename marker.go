@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// readMarker returns the time of the last successful run recorded in the -newer-than-file marker.
+// a missing marker means the tool has not run yet, so the zero time is returned and everything is imported
+func readMarker(filename string) (time.Time, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+}
+
+// writeMarker records the start of a successful run, so the next run only picks up newer results
+func writeMarker(filename string, t time.Time) error {
+	return ioutil.WriteFile(filename, []byte(t.UTC().Format(time.RFC3339)+"\n"), 0644)
+}
+
+// filterNewerThan drops results discovered before the given time.
+// results without a usable timestamp are kept, since we can't tell how old they are
+func filterNewerThan(results []amassResult, since time.Time) []amassResult {
+	kept := []amassResult{}
+	for _, r := range results {
+		if t, ok := r.discovered(); ok && t.Before(since) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
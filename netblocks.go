@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// minSynthesizedPrefix is the broadest netblock -synthesize-netblocks may make up, anything wider would
+// claim a lot of address space on the strength of a few hosts
+const minSynthesizedPrefix = 16
+
+// synthesizeNetblocks makes up netblocks of the given prefix length for IPv4 addresses that no netblock covers.
+// a range is only synthesized when at least two of the addresses fall into it, a single host says nothing
+// about the network around it. the netblocks are returned in address order
+func synthesizeNetblocks(ips []string, prefix int, existing []lair.Netblock) []lair.Netblock {
+	covered := []*net.IPNet{}
+	for _, n := range existing {
+		if _, network, err := net.ParseCIDR(n.CIDR); err == nil {
+			covered = append(covered, network)
+		}
+	}
+	mask := net.CIDRMask(prefix, 32)
+	members := map[string]map[string]bool{}
+	for _, ip := range ips {
+		addr := net.ParseIP(ip).To4()
+		if addr == nil || inNetworks(covered, addr) {
+			continue
+		}
+		network := (&net.IPNet{IP: addr.Mask(mask), Mask: mask}).String()
+		if members[network] == nil {
+			members[network] = map[string]bool{}
+		}
+		members[network][addr.String()] = true
+	}
+	cidrs := []string{}
+	for cidr, hosts := range members {
+		if len(hosts) >= 2 {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	sort.Slice(cidrs, func(i, j int) bool {
+		a, _, _ := net.ParseCIDR(cidrs[i])
+		b, _, _ := net.ParseCIDR(cidrs[j])
+		return string(a.To4()) < string(b.To4())
+	})
+	netblocks := []lair.Netblock{}
+	for _, cidr := range cidrs {
+		netblocks = append(netblocks, lair.Netblock{
+			CIDR:        cidr,
+			ASN:         "0",
+			Description: fmt.Sprintf("synthesized by %s from %d hosts", tool, len(members[cidr])),
+		})
+	}
+	return netblocks
+}
+
+// inNetworks reports whether any of the networks contains ip
+func inNetworks(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// netblockOf returns the most specific of the netblocks that contains ip, or "" if none does
+func netblockOf(ip string, netblocks []*net.IPNet) string {
+	addr := net.ParseIP(ip)
+	best, bestOnes := "", -1
+	for _, n := range netblocks {
+		if ones, _ := n.Mask.Size(); n.Contains(addr) && ones > bestOnes {
+			best, bestOnes = n.String(), ones
+		}
+	}
+	return best
+}
+
+// propagateTags copies the lair tags of the matched hosts that start with one of the prefixes to every host in
+// the same netblock, for -propagate-tags. hosts outside every netblock get nothing, and tags a host already has
+// in lair aren't added again. it returns how many tags were added
+func propagateTags(hosts, existing []lair.Host, matched map[string]bool, netblocks []lair.Netblock, prefixes []string) int {
+	networks := []*net.IPNet{}
+	for _, n := range netblocks {
+		if _, network, err := net.ParseCIDR(n.CIDR); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	had := map[string][]string{}
+	shared := map[string][]string{}
+	for _, h := range existing {
+		had[h.IPv4] = h.Tags
+		cidr := netblockOf(h.IPv4, networks)
+		if !matched[h.IPv4] || cidr == "" {
+			continue
+		}
+		for _, tag := range h.Tags {
+			for _, p := range prefixes {
+				if p = strings.TrimSpace(p); p != "" && strings.HasPrefix(tag, p) {
+					shared[cidr] = appendUnique(shared[cidr], tag)
+					break
+				}
+			}
+		}
+	}
+	added := 0
+	for i, h := range hosts {
+		for _, tag := range shared[netblockOf(h.IPv4, networks)] {
+			if hasTag(had[h.IPv4], tag) || hasTag(hosts[i].Tags, tag) {
+				continue
+			}
+			hosts[i].Tags = append(hosts[i].Tags, tag)
+			added++
+		}
+	}
+	return added
+}
+
+// hasTag reports whether tags has tag
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// splitIPPort splits a trailing port off an address like "1.2.3.4:443" or "[2001:db8::1]:443".
+// addresses without a port (including bare IPv6 addresses) are returned unchanged with a port of 0
+func splitIPPort(address string) (string, int) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, 0
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return address, 0
+	}
+	return host, n
+}
+
+// stripPorts removes ports from every result address so they can be compared against host IPs,
+// the port is kept on the address in case it should be imported as a service
+func stripPorts(results []amassResult) {
+	for i := range results {
+		for j := range results[i].Addresses {
+			a := &results[i].Addresses[j]
+			a.IP, a.Port = splitIPPort(a.IP)
+		}
+	}
+}
+
+// longIPv4 is the integer form of an IPv4 address that lair sorts hosts by, 1.2.3.4 is 16909060.
+// it is 0 for anything that isn't an IPv4 address
+func longIPv4(ip string) uint64 {
+	v4 := net.ParseIP(ip).To4()
+	if v4 == nil {
+		return 0
+	}
+	return uint64(v4[0])<<24 | uint64(v4[1])<<16 | uint64(v4[2])<<8 | uint64(v4[3])
+}
+
+// canonicalCIDR returns the network address form of a CIDR, so "1.2.3.4/24" becomes "1.2.3.0/24".
+// anything that doesn't parse is returned unchanged
+func canonicalCIDR(cidr string) string {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return network.String()
+}
+
+// normalizeCIDRs canonicalizes the CIDR of every result address, it returns each rewrite once
+func normalizeCIDRs(results []amassResult) []collapse {
+	rewritten := []collapse{}
+	seen := map[string]bool{}
+	for i := range results {
+		for j := range results[i].Addresses {
+			a := &results[i].Addresses[j]
+			canonical := canonicalCIDR(a.Cidr)
+			if canonical != a.Cidr && !seen[a.Cidr] {
+				seen[a.Cidr] = true
+				rewritten = append(rewritten, collapse{Kind: "netblock", Original: a.Cidr, Canonical: canonical, Reason: "host bits set in CIDR"})
+			}
+			a.Cidr = canonical
+		}
+	}
+	return rewritten
+}
+
+// stripNamePorts removes a trailing port from result names, some sources report "example.com:8443" or
+// "[2001:db8::1]:443" for the service they saw the name on. the port moves onto the result's addresses
+// that don't have one yet, so -import-ports can add it as a service. it returns how many names had a port
+func stripNamePorts(results []amassResult) int {
+	stripped := 0
+	for i := range results {
+		name, port := splitIPPort(results[i].Name)
+		if port == 0 {
+			continue
+		}
+		stripped++
+		results[i].Name = name
+		for j := range results[i].Addresses {
+			if results[i].Addresses[j].Port == 0 {
+				results[i].Addresses[j].Port = port
+			}
+		}
+	}
+	return stripped
+}
+
+// collapseWhitespace trims s and turns every run of whitespace inside it (tabs, newlines) into a single space
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// normalizeWhitespace cleans up the names, domains and address descriptions of every result, which
+// otherwise render badly in lair. it returns how many results were changed
+func normalizeWhitespace(results []amassResult) int {
+	changed := 0
+	for i := range results {
+		r := &results[i]
+		fields := []*string{&r.Name, &r.Domain}
+		for j := range r.Addresses {
+			fields = append(fields, &r.Addresses[j].Desc)
+		}
+		dirty := false
+		for _, f := range fields {
+			if clean := collapseWhitespace(*f); clean != *f {
+				*f = clean
+				dirty = true
+			}
+		}
+		if dirty {
+			changed++
+		}
+	}
+	return changed
+}
+
+// normalizeMACs puts every MAC address the results carry in lair's lower case, colon separated form.
+// malformed ones are dropped with a warning so they can't end up on a host
+func normalizeMACs(results []amassResult) {
+	for i := range results {
+		for j := range results[i].Addresses {
+			a := &results[i].Addresses[j]
+			if a.MAC == "" {
+				continue
+			}
+			hw, err := net.ParseMAC(a.MAC)
+			if err != nil || len(hw) != 6 {
+				warnf("Ignoring invalid MAC address %q of %s on %s", a.MAC, a.IP, results[i].Name)
+				a.MAC = ""
+				continue
+			}
+			a.MAC = hw.String()
+		}
+	}
+}
+
+// mergeMAC picks the MAC for a host with -merge-mac: the one lair already has wins, otherwise the first one
+// the results reported. disagreements are warned about since they point at a reused IP
+func mergeMAC(ip, existing string, found []string) string {
+	mac := existing
+	for _, m := range found {
+		if mac == "" {
+			mac = m
+		} else if !strings.EqualFold(mac, m) {
+			warnf("Conflicting MAC addresses for %s, keeping %s over %s", ip, mac, m)
+		}
+	}
+	return mac
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// writeCSV writes every parsed result to a spreadsheet friendly csv file, one row per address.
+// results without addresses still get a row so no discovered name is missing
+func writeCSV(filename string, results []amassResult) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"name", "ip", "cidr", "asn", "source", "domain"}); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if len(r.Addresses) == 0 {
+			if err := w.Write([]string{r.Name, "", "", "", r.Source, r.Domain}); err != nil {
+				return err
+			}
+		}
+		for _, a := range r.Addresses {
+			if err := w.Write([]string{r.Name, a.IP, a.Cidr, a.Asn.String(), r.Source, r.Domain}); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// listHostname is the form a result's name takes in the -hosts-out list, lower cased. wildcard names are
+// left out, the tools the list is meant for can't do anything with them
+func listHostname(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if name == "" || strings.Contains(name, "*") {
+		return "", false
+	}
+	return name, true
+}
+
+// hostnameList is every distinct name in the results for -hosts-out, sorted
+func hostnameList(results []amassResult) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, r := range results {
+		name, ok := listHostname(r.Name)
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ipLess orders addresses numerically with IPv4 first, then IPv6
+func ipLess(x, y net.IP) bool {
+	a, b := x.To4(), y.To4()
+	if (a == nil) != (b == nil) {
+		return a != nil
+	}
+	if a == nil {
+		a, b = x.To16(), y.To16()
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+// ipList is every distinct address in the results for -ips-out, in numeric order with IPv4 first
+func ipList(results []amassResult) []string {
+	seen := map[string]bool{}
+	ips := []net.IP{}
+	for _, r := range results {
+		for _, a := range r.Addresses {
+			ip := net.ParseIP(a.IP)
+			if ip == nil || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			ips = append(ips, ip)
+		}
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return ipLess(ips[i], ips[j])
+	})
+	list := []string{}
+	for _, ip := range ips {
+		list = append(list, ip.String())
+	}
+	return list
+}
+
+// listWriter writes the -hosts-out and -ips-out lists an entry at a time, so -stream-lists can write them while
+// the results are still being parsed. entries it already wrote are skipped, which means every distinct entry
+// stays in memory until the list is closed. that is a lot less than the parsed results, but it isn't flat. a
+// filename ending in .jsonl gets json lines like {"hostname": "www.example.com"}, anything else one plain entry per line
+type listWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	key   string
+	jsonl bool
+	seen  map[string]bool
+}
+
+// newListWriter creates the list file, key is the json field the entries go in
+func newListWriter(filename, key string) (*listWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &listWriter{
+		f:     f,
+		w:     bufio.NewWriter(f),
+		key:   key,
+		jsonl: strings.HasSuffix(strings.ToLower(filename), ".jsonl"),
+		seen:  map[string]bool{},
+	}, nil
+}
+
+// add writes the entry unless it was written before
+func (l *listWriter) add(entry string) error {
+	if l.seen[entry] {
+		return nil
+	}
+	l.seen[entry] = true
+	if l.jsonl {
+		line, err := json.Marshal(map[string]string{l.key: entry})
+		if err != nil {
+			return err
+		}
+		entry = string(line)
+	}
+	_, err := l.w.WriteString(entry + "\n")
+	return err
+}
+
+// addResult writes the entries a result has for the list, its name for hostnames and its addresses for ips
+func (l *listWriter) addResult(r amassResult) error {
+	if l.key == "hostname" {
+		if name, ok := listHostname(r.Name); ok {
+			return l.add(name)
+		}
+		return nil
+	}
+	for _, a := range r.Addresses {
+		if ip := net.ParseIP(a.IP); ip != nil {
+			if err := l.add(ip.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// close flushes and closes the file. it can be called again, e.g. deferred for the error paths
+func (l *listWriter) close() error {
+	if l.f == nil {
+		return nil
+	}
+	f := l.f
+	l.f = nil
+	if err := l.w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// streamListConflicts returns the flags given in opts that drop, rewrite or collapse results after parsing.
+// -stream-lists writes the lists before those run, so the lists would have entries the sorted lists don't
+func streamListConflicts(opts options) []string {
+	conflicts := []string{}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"-newer-than-file", opts.newerThanFile != ""},
+		{"-rules", opts.rulesFile != ""},
+		{"-hostname-rewrite", len(opts.hostnameRewrites) > 0},
+		{"-drop-suffix", opts.dropSuffix != ""},
+		{"-exclude-ip", opts.excludeIP != ""},
+		{"-hostname-include-regex", opts.includeRegex != ""},
+		{"-hostname-exclude-regex", opts.excludeRegex != ""},
+		{"-min-hostname-length", opts.minNameLength > 0},
+		{"-ignore-private-ips", opts.ignorePrivateIPs},
+		{"-address-family", opts.addressFamily != familyBoth},
+		{"-scope-file", opts.scopeFile != ""},
+		{"-strip-www", opts.stripWWW},
+		{"-strip-prefix", opts.stripPrefix != ""},
+		{"-ct-dedup", opts.ctDedup},
+		{"-collapse-cnames", opts.collapseCNAMEs},
+		{"-limit", opts.limit > 0},
+	} {
+		if f.set {
+			conflicts = append(conflicts, f.name)
+		}
+	}
+	return conflicts
+}
+
+// cleanForList gives a streamed result the same clean up run gives every result right after parsing
+// (whitespace, -max-address-per-result, -strip-port and -strip-hostname-ports), on a copy so the parsed result is
+// left as it was for -output-csv
+func cleanForList(r amassResult, opts options) amassResult {
+	r.Addresses = append([]amassAddress(nil), r.Addresses...)
+	one := []amassResult{r}
+	if !opts.noNormalize {
+		normalizeWhitespace(one)
+	}
+	if opts.maxAddresses > 0 {
+		capAddresses(one, opts.maxAddresses)
+	}
+	if opts.stripPort {
+		stripPorts(one)
+	}
+	if opts.stripHostnamePorts {
+		stripNamePorts(one)
+	}
+	return one[0]
+}
+
+// writeLines writes a whole list at once, one entry per line or json lines (see listWriter)
+func writeLines(filename, key string, lines []string) error {
+	l, err := newListWriter(filename, key)
+	if err != nil {
+		return err
+	}
+	defer l.close()
+	for _, line := range lines {
+		if err := l.add(line); err != nil {
+			return err
+		}
+	}
+	return l.close()
+}
+
+// unmatchedResult is a result that didn't end up on an existing lair host, along with why
+type unmatchedResult struct {
+	amassResult
+	Reason string `json:"reason"`
+}
+
+// findUnmatched works out which results didn't match any host already in the project
+func findUnmatched(results []amassResult, hosts []lair.Host, keepWildcards bool) []unmatchedResult {
+	ips := map[string]bool{}
+	for _, h := range hosts {
+		ips[h.IPv4] = true
+	}
+	unmatched := []unmatchedResult{}
+	for _, r := range results {
+		reason := ""
+		switch {
+		case strings.Contains(r.Name, "*") && !keepWildcards:
+			reason = "wildcard name"
+		case len(r.Addresses) == 0:
+			reason = "no addresses"
+		default:
+			reason = "no matching host in project"
+			for _, a := range r.Addresses {
+				if ips[a.IP] {
+					reason = ""
+					break
+				}
+			}
+		}
+		if reason != "" {
+			unmatched = append(unmatched, unmatchedResult{amassResult: r, Reason: reason})
+		}
+	}
+	return unmatched
+}
+
+// writeUnmatched writes the unmatched results for triage, as csv if the filename ends in .csv and json otherwise
+func writeUnmatched(filename string, unmatched []unmatchedResult) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
+		w := csv.NewWriter(f)
+		if err := w.Write([]string{"name", "domain", "ips", "cidrs", "sources", "reason"}); err != nil {
+			return err
+		}
+		for _, u := range unmatched {
+			ips := []string{}
+			cidrs := []string{}
+			for _, a := range u.Addresses {
+				ips = append(ips, a.IP)
+				cidrs = append(cidrs, a.Cidr)
+			}
+			row := []string{u.Name, u.Domain, strings.Join(ips, ";"), strings.Join(cidrs, ";"), strings.Join(u.Sources, ";"), u.Reason}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(unmatched); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writeDedupeReport writes what the dedupe steps collapsed, as csv if the filename ends in .csv and json otherwise
+func writeDedupeReport(filename string, collapsed []collapse) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
+		w := csv.NewWriter(f)
+		if err := w.Write([]string{"kind", "original", "canonical", "reason"}); err != nil {
+			return err
+		}
+		for _, c := range collapsed {
+			if err := w.Write([]string{c.Kind, c.Original, c.Canonical, c.Reason}); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(collapsed); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// readCSV reads every row of a csv file
+func readCSV(t *testing.T, filename string) [][]string {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("%s is not valid csv: %v", filename, err)
+	}
+	return rows
+}
+
+func TestWriteCSV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "out.csv")
+	results := []amassResult{
+		{Name: "www.example.com", Domain: "example.com", Source: `Brute Forcing, "alterations"`, Addresses: []amassAddress{
+			{IP: "1.2.3.4", Cidr: "1.2.3.0/24", Asn: "13335", Desc: "Example Net, Inc"},
+			{IP: "2001:db8::1", Cidr: "2001:db8::/32", Asn: "13335"},
+		}},
+		{Name: "noaddress.example.com", Domain: "example.com", Source: "DNS"},
+	}
+	if err := writeCSV(filename, results); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "ip", "cidr", "asn", "source", "domain"},
+		{"www.example.com", "1.2.3.4", "1.2.3.0/24", "13335", `Brute Forcing, "alterations"`, "example.com"},
+		{"www.example.com", "2001:db8::1", "2001:db8::/32", "13335", `Brute Forcing, "alterations"`, "example.com"},
+		{"noaddress.example.com", "", "", "", "DNS", "example.com"},
+	}
+	if got := readCSV(t, filename); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// readList reads a list file back as its lines
+func readList(t *testing.T, filename string) []string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestListWriterStreamsDistinctEntries(t *testing.T) {
+	dir := t.TempDir()
+	hosts, err := newListWriter(filepath.Join(dir, "hosts.txt"), "hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips, err := newListWriter(filepath.Join(dir, "ips.jsonl"), "ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []amassResult{
+		{Name: "WWW.example.com", Addresses: []amassAddress{{IP: "1.2.3.4"}, {IP: "2001:db8:0::1"}}},
+		{Name: "*.example.com", Addresses: []amassAddress{{IP: "1.2.3.4"}, {IP: "not an ip"}}},
+		{Name: "www.example.com", Addresses: []amassAddress{{IP: "1.2.3.5"}}},
+	}
+	for _, r := range results {
+		if err := hosts.addResult(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := ips.addResult(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hosts.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ips.close(); err != nil {
+		t.Fatal(err)
+	}
+	// a second close, like the deferred one after a successful run, is harmless
+	if err := ips.close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readList(t, filepath.Join(dir, "hosts.txt")), []string{"www.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts %q, want %q", got, want)
+	}
+	want := []string{`{"ip":"1.2.3.4"}`, `{"ip":"2001:db8::1"}`, `{"ip":"1.2.3.5"}`}
+	if got := readList(t, filepath.Join(dir, "ips.jsonl")); !reflect.DeepEqual(got, want) {
+		t.Errorf("got ips %q, want %q", got, want)
+	}
+}
+
+func TestWriteLinesMatchesSortedLists(t *testing.T) {
+	results := []amassResult{
+		{Name: "b.example.com", Addresses: []amassAddress{{IP: "2001:db8::1"}, {IP: "10.0.0.2"}}},
+		{Name: "A.example.com", Addresses: []amassAddress{{IP: "9.9.9.9"}, {IP: "10.0.0.2"}}},
+	}
+	filename := filepath.Join(t.TempDir(), "hosts.jsonl")
+	if err := writeLines(filename, "hostname", hostnameList(results)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{"hostname":"a.example.com"}`, `{"hostname":"b.example.com"}`}
+	if got := readList(t, filename); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := ipList(results), []string{"9.9.9.9", "10.0.0.2", "2001:db8::1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got ips %q, want %q", got, want)
+	}
+}
+
+// BenchmarkHostsOutSorted is -hosts-out as it is written without -stream-lists, sorted after parsing
+func BenchmarkHostsOutSorted(b *testing.B) {
+	results := benchResults(100000)
+	filename := filepath.Join(b.TempDir(), "hosts.txt")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := writeLines(filename, "hostname", hostnameList(results)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHostsOutStreamed is -hosts-out with -stream-lists, written a result at a time
+func BenchmarkHostsOutStreamed(b *testing.B) {
+	results := benchResults(100000)
+	filename := filepath.Join(b.TempDir(), "hosts.txt")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l, err := newListWriter(filename, "hostname")
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, r := range results {
+			if err := l.addResult(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := l.close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRunStreamListsCleansResults(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions()
+	opts.maxAddresses = 1024
+	opts.streamLists = true
+	opts.stripPort = true
+	opts.stripHostnamePorts = true
+	opts.hostsOut = filepath.Join(dir, "hosts.txt")
+	opts.ipsOut = filepath.Join(dir, "ips.txt")
+	project := lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}}}
+	runImport(t, opts, project,
+		`{"name":"www.example.com:8443","addresses":[{"ip":"1.2.3.4:443"}]}`,
+		`{"name":" mail.example.com\t","addresses":[{"ip":"1.2.3.5"}]}`,
+	)
+	// the same entries the sorted lists get, in the order they were found
+	if got, want := readList(t, opts.hostsOut), []string{"www.example.com", "mail.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts %q, want %q", got, want)
+	}
+	if got, want := readList(t, opts.ipsOut), []string{"1.2.3.4", "1.2.3.5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got ips %q, want %q", got, want)
+	}
+}
+
+func TestRunStreamListsRejectsFilters(t *testing.T) {
+	opts := testOptions()
+	opts.streamLists = true
+	opts.hostsOut = filepath.Join(t.TempDir(), "hosts.txt")
+	opts.ignorePrivateIPs = true
+	opts.limit = 10
+	err := run(opts, []string{"p1", "amass.json"})
+	if err == nil || !strings.Contains(err.Error(), "can't be used with -ignore-private-ips, -limit") {
+		t.Errorf("got %v, want -stream-lists rejected with both flags", err)
+	}
+}
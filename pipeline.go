@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Concurrency model
+//
+// parsing and merging are pipelined: the parser runs in its own goroutine and hands each result
+// over a channel, while everything the merge touches (the results slice, tagSet, hNotFound, nNotFound,
+// project.Hosts and project.Netblocks) is owned by the goroutine that called run. nothing is shared
+// between goroutines except the channels, so none of that state needs locking. new parallel stages
+// should follow the same rule and send their output to the owner instead of writing shared maps.
+// -parse-workers does: every worker decodes its own chunk of the file into its own slice, and the
+// parser goroutine hands the slices on in file order.
+
+// parser is the signature of the format specific parsers, they call f for every decoded result. f returns
+// false when the caller wants no more results, the parser then returns without decoding the rest
+type parser func(data []byte, f func(amassResult) bool) error
+
+// lineErrors are the lines a parser skipped because they couldn't be parsed. parsers keep going past a bad
+// line and return these at the end, so the caller decides whether a partly parsed file is good enough
+type lineErrors []error
+
+func (e lineErrors) Error() string {
+	return fmt.Sprintf("%d lines could not be parsed, the first was %s", len(e), e[0])
+}
+
+// lineError is a line a parser couldn't parse, the line number is kept apart so -parse-workers can turn the
+// line number within a chunk into the line number within the file
+type lineError struct {
+	line int
+	err  error
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.err)
+}
+
+func (e *lineError) Unwrap() error {
+	return e.err
+}
+
+// errOrNil keeps an empty lineErrors from turning into a non-nil error interface
+func (e lineErrors) errOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// streamResults starts parsing data in the background. results are delivered in file order on the
+// first channel, which is closed when parsing ends, after which the second channel yields the parse error (or nil).
+// closing done makes the parser stop early, the caller must do that if it stops reading before the end
+func streamResults(data []byte, parse parser, done <-chan struct{}) (<-chan amassResult, <-chan error) {
+	results := make(chan amassResult, 64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(results)
+		errc <- parse(data, func(r amassResult) bool {
+			select {
+			case results <- r:
+				return true
+			case <-done:
+				return false
+			}
+		})
+	}()
+	return results, errc
+}
+
+// lineChunk is a part of the input that starts and ends on a line boundary, line is how many lines come before it
+type lineChunk struct {
+	data []byte
+	line int
+}
+
+// splitLines cuts data into at most n chunks of about the same size, each ending just after a newline so no
+// line is split between two chunks
+func splitLines(data []byte, n int) []lineChunk {
+	chunks := []lineChunk{}
+	size := len(data)/n + 1
+	line := 0
+	for start := 0; start < len(data); {
+		end := start + size
+		if end >= len(data) {
+			end = len(data)
+		} else if i := bytes.IndexByte(data[end:], '\n'); i >= 0 {
+			end += i + 1
+		} else {
+			end = len(data)
+		}
+		chunks = append(chunks, lineChunk{data: data[start:end], line: line})
+		line += bytes.Count(data[start:end], []byte("\n"))
+		start = end
+	}
+	return chunks
+}
+
+// parallelParser is parse spread over -parse-workers goroutines, each decoding one chunk of the file. the
+// results are handed to f in file order, chunk by chunk as they finish, so the output is the same as parse's.
+// skipped lines are reported with their line in the file, an error that stops parse stops at its chunk.
+// closing done stops the workers too, f only sees a chunk once it is decoded so it can't stop them itself
+func parallelParser(parse parser, workers int, done <-chan struct{}) parser {
+	return func(data []byte, f func(amassResult) bool) error {
+		type parsed struct {
+			results []amassResult
+			err     error
+		}
+		// closed once nothing more is wanted, so the workers still decoding stop too
+		stop := make(chan struct{})
+		defer close(stop)
+		chunks := splitLines(data, workers)
+		outs := make([]chan parsed, len(chunks))
+		for n, c := range chunks {
+			outs[n] = make(chan parsed, 1)
+			go func(c lineChunk, out chan<- parsed) {
+				var p parsed
+				p.err = parse(c.data, func(r amassResult) bool {
+					select {
+					case <-stop:
+						return false
+					case <-done:
+						return false
+					default:
+					}
+					p.results = append(p.results, r)
+					return true
+				})
+				out <- p
+			}(c, outs[n])
+		}
+		var bad lineErrors
+		for n, out := range outs {
+			var p parsed
+			select {
+			case p = <-out:
+			case <-done:
+				return nil
+			}
+			for _, r := range p.results {
+				if !f(r) {
+					return nil
+				}
+			}
+			if p.err == nil {
+				continue
+			}
+			var skipped lineErrors
+			if !errors.As(p.err, &skipped) {
+				return fmt.Errorf("in the chunk from line %d: %w", chunks[n].line+1, p.err)
+			}
+			for _, e := range skipped {
+				var le *lineError
+				if errors.As(e, &le) {
+					le.line += chunks[n].line
+				}
+				bad = append(bad, e)
+			}
+		}
+		return bad.errOrNil()
+	}
+}
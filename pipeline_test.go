@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// jsonLines builds n amass json lines, every line listed in bad is garbage instead
+func jsonLines(n int, bad ...int) []byte {
+	garbage := map[int]bool{}
+	for _, b := range bad {
+		garbage[b] = true
+	}
+	var buf bytes.Buffer
+	for i := 1; i <= n; i++ {
+		if garbage[i] {
+			buf.WriteString("{not json\n")
+			continue
+		}
+		fmt.Fprintf(&buf, `{"name":"host%d.example.com","domain":"example.com","addresses":[{"ip":"10.0.%d.%d","cidr":"10.0.0.0/8","asn":%d,"desc":"net"}],"tag":"dns","sources":["DNS"]}`+"\n", i, i/256, i%256, i)
+	}
+	return buf.Bytes()
+}
+
+// collect parses data and returns the results in the order f got them
+func collect(t *testing.T, parse parser, data []byte) ([]amassResult, error) {
+	t.Helper()
+	var results []amassResult
+	err := parse(data, func(r amassResult) bool {
+		results = append(results, r)
+		return true
+	})
+	return results, err
+}
+
+func TestStreamResultsKeepsFileOrder(t *testing.T) {
+	data := jsonLines(500)
+	done := make(chan struct{})
+	defer close(done)
+	results, errc := streamResults(data, parseJsonLines, done)
+	n := 0
+	for r := range results {
+		n++
+		if want := fmt.Sprintf("host%d.example.com", n); r.Name != want {
+			t.Fatalf("result %d is %s, want %s", n, r.Name, want)
+		}
+	}
+	if n != 500 {
+		t.Fatalf("got %d results, want 500", n)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected parse error %v", err)
+	}
+}
+
+func TestStreamResultsStopsWhenDoneIsClosed(t *testing.T) {
+	data := jsonLines(10000)
+	calls := 0
+	counting := func(data []byte, f func(amassResult) bool) error {
+		return parseJsonLines(data, func(r amassResult) bool {
+			calls++
+			return f(r)
+		})
+	}
+	done := make(chan struct{})
+	results, errc := streamResults(data, counting, done)
+	for i := 0; i < 10; i++ {
+		<-results
+	}
+	close(done)
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("unexpected parse error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the parser kept running after done was closed")
+	}
+	// the channel buffer and the result in flight are all the parser may get ahead by
+	if calls > 10+cap(results)+1 {
+		t.Fatalf("the parser decoded %d results after being stopped at 10", calls)
+	}
+}
+
+func TestParallelParserMatchesSerial(t *testing.T) {
+	data := jsonLines(1000, 3, 250, 999)
+	want, wantErr := collect(t, parseJsonLines, data)
+	var wantBad lineErrors
+	if !errors.As(wantErr, &wantBad) {
+		t.Fatalf("serial parse returned %v, want lineErrors", wantErr)
+	}
+	for _, workers := range []int{1, 2, 3, 7, 16} {
+		got, err := collect(t, parallelParser(parseJsonLines, workers, nil), data)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers: results differ from the serial parse", workers)
+		}
+		var bad lineErrors
+		if !errors.As(err, &bad) {
+			t.Fatalf("%d workers: got error %v, want lineErrors", workers, err)
+		}
+		if fmt.Sprint(bad) != fmt.Sprint(wantBad) {
+			t.Errorf("%d workers: skipped lines %v, want %v", workers, bad, wantBad)
+		}
+	}
+}
+
+func TestParallelParserStopsOnDone(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	got, err := collect(t, parallelParser(parseJsonLines, 4, done), jsonLines(10000))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %d results after done was closed, want none", len(got))
+	}
+}
+
+func TestParallelParserStopsWhenFDoes(t *testing.T) {
+	n := 0
+	err := parallelParser(parseJsonLines, 4, nil)(jsonLines(1000), func(r amassResult) bool {
+		n++
+		return n < 5
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("f was called %d times after asking to stop at 5", n)
+	}
+}
+
+func TestStreamResultsWithParallelParserUnderRace(t *testing.T) {
+	// the merge owns everything it touches, this is what -race checks when parsing runs on several workers
+	done := make(chan struct{})
+	defer close(done)
+	results, errc := streamResults(jsonLines(2000), parallelParser(parseJsonLines, 8, done), done)
+	seen := map[string]bool{}
+	for r := range results {
+		seen[r.Name] = true
+	}
+	if len(seen) != 2000 {
+		t.Fatalf("got %d distinct results, want 2000", len(seen))
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected parse error %v", err)
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	data := []byte("a\nbb\nccc\ndddd\neeeee\nf")
+	for n := 1; n <= 8; n++ {
+		chunks := splitLines(data, n)
+		if len(chunks) > n {
+			t.Errorf("%d chunks for n=%d", len(chunks), n)
+		}
+		var joined []byte
+		line := 0
+		for i, c := range chunks {
+			if c.line != line {
+				t.Errorf("n=%d chunk %d starts at line %d, want %d", n, i, c.line, line)
+			}
+			if i < len(chunks)-1 && !bytes.HasSuffix(c.data, []byte("\n")) {
+				t.Errorf("n=%d chunk %d %q doesn't end on a line boundary", n, i, c.data)
+			}
+			line += bytes.Count(c.data, []byte("\n"))
+			joined = append(joined, c.data...)
+		}
+		if !bytes.Equal(joined, data) {
+			t.Errorf("n=%d chunks join to %q", n, joined)
+		}
+	}
+}
+
+// BenchmarkParseWorkers decodes 100k json lines with each -parse-workers count
+func BenchmarkParseWorkers(b *testing.B) {
+	data := jsonLines(100000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			parse := parseJsonLines
+			if workers > 1 {
+				parse = parallelParser(parseJsonLines, workers, nil)
+			}
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				n := 0
+				if err := parse(data, func(amassResult) bool {
+					n++
+					return true
+				}); err != nil || n != 100000 {
+					b.Fatalf("got %d results and %v", n, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// staleHostnames works out, for every existing host that shows up in the results, which of the hostnames it
+// has in lair amass no longer reports for its IP. hosts that amass didn't see at all are left alone, their
+// hostnames may well have come from other tools
+func staleHostnames(hosts []lair.Host, results []amassResult) map[string][]string {
+	current := map[string]map[string]bool{}
+	for _, r := range results {
+		for _, a := range r.Addresses {
+			if current[a.IP] == nil {
+				current[a.IP] = map[string]bool{}
+			}
+			current[a.IP][strings.ToLower(r.Name)] = true
+		}
+	}
+	stale := map[string][]string{}
+	for _, h := range hosts {
+		names, ok := current[h.IPv4]
+		if !ok {
+			continue
+		}
+		for _, hostname := range h.Hostnames {
+			if !names[strings.ToLower(hostname)] {
+				stale[h.IPv4] = appendUnique(stale[h.IPv4], hostname)
+			}
+		}
+	}
+	return stale
+}
+
+// staleReport is the -delete-missing preview, it is always shown before anything is removed
+func staleReport(stale map[string][]string) report {
+	ips := []string{}
+	for ip := range stale {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	r := report{key: "staleHostnames", title: "Stale hostnames", columns: []string{"ip", "hostnames"}, value: stale}
+	for _, ip := range ips {
+		r.rows = append(r.rows, []string{ip, strings.Join(stale[ip], ", ")})
+	}
+	return r
+}
+
+// removeHostnames returns hostnames without the ones in remove
+func removeHostnames(hostnames, remove []string) []string {
+	drop := map[string]bool{}
+	for _, r := range remove {
+		drop[r] = true
+	}
+	kept := []string{}
+	for _, h := range hostnames {
+		if !drop[h] {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+// printHostDiffs is the -verbose-diff-hosts output. for every host amass reported names for it shows which
+// hostnames the import adds (+), which were already in lair (=) and which it removes (-)
+func printHostDiffs(before map[string][]string, hosts []lair.Host, results []amassResult) {
+	reported := map[string]map[string]bool{}
+	for _, r := range results {
+		for _, a := range r.Addresses {
+			if reported[a.IP] == nil {
+				reported[a.IP] = map[string]bool{}
+			}
+			reported[a.IP][strings.ToLower(r.Name)] = true
+		}
+	}
+	sorted := append([]lair.Host{}, hosts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].IPv4 < sorted[j].IPv4
+	})
+	for _, h := range sorted {
+		had := map[string]bool{}
+		for _, name := range before[h.IPv4] {
+			had[strings.ToLower(name)] = true
+		}
+		has := map[string]bool{}
+		lines := []string{}
+		for _, name := range h.Hostnames {
+			key := strings.ToLower(name)
+			if has[key] {
+				continue
+			}
+			has[key] = true
+			if !had[key] {
+				lines = append(lines, "  + "+name)
+			} else if reported[h.IPv4][key] {
+				lines = append(lines, "  = "+name)
+			}
+		}
+		for _, name := range before[h.IPv4] {
+			if !has[strings.ToLower(name)] {
+				lines = append(lines, "  - "+name)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Println(h.IPv4)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+}
+
+// printAddressMatches is the -include-raw-addresses output, for diagnosing results that don't match. every
+// address is printed exactly as it is compared, quoted so stray whitespace or ports show up, with the host
+// it matched or why it didn't
+func printAddressMatches(results []amassResult, hosts []lair.Host, keepWildcards bool) {
+	ips := map[string]bool{}
+	for _, h := range hosts {
+		ips[h.IPv4] = true
+	}
+	for _, r := range results {
+		fmt.Println(r.Name)
+		if len(r.Addresses) == 0 {
+			fmt.Println("  no addresses")
+			continue
+		}
+		for _, a := range r.Addresses {
+			outcome := "no host with this IP"
+			switch {
+			case strings.Contains(r.Name, "*") && !keepWildcards:
+				outcome = "not matched, wildcard name"
+			case ips[a.IP]:
+				outcome = "matched host " + a.IP
+			}
+			fmt.Printf("  ip=%q cidr=%q asn=%s desc=%q port=%d -> %s\n", a.IP, a.Cidr, a.Asn, a.Desc, a.Port, outcome)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// resultAt is a result for name resolving to ips
+func resultAt(name string, ips ...string) amassResult {
+	r := amassResult{Name: name}
+	for _, ip := range ips {
+		r.Addresses = append(r.Addresses, amassAddress{IP: ip})
+	}
+	return r
+}
+
+func TestStaleHostnames(t *testing.T) {
+	hosts := []lair.Host{
+		{IPv4: "1.2.3.4", Hostnames: []string{"www.example.com", "old.example.com", "Mail.Example.com"}},
+		// amass didn't see this IP at all, so nothing on it is stale
+		{IPv4: "5.6.7.8", Hostnames: []string{"gone.example.com"}},
+		{IPv4: "9.9.9.9", Hostnames: []string{"api.example.com"}},
+	}
+	results := []amassResult{
+		resultAt("www.example.com", "1.2.3.4"),
+		resultAt("mail.example.com", "1.2.3.4", "9.9.9.9"),
+		resultAt("api.example.com", "9.9.9.9"),
+	}
+	got := staleHostnames(hosts, results)
+	want := map[string][]string{"1.2.3.4": {"old.example.com"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStaleHostnamesNothingReported(t *testing.T) {
+	hosts := []lair.Host{{IPv4: "1.2.3.4", Hostnames: []string{"www.example.com"}}}
+	if got := staleHostnames(hosts, nil); len(got) != 0 {
+		t.Fatalf("got %v, want nothing stale", got)
+	}
+}
+
+func TestRemoveHostnames(t *testing.T) {
+	got := removeHostnames([]string{"a.example.com", "b.example.com", "c.example.com"}, []string{"b.example.com"})
+	want := []string{"a.example.com", "c.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStaleReportRowsInIPOrder(t *testing.T) {
+	r := staleReport(map[string][]string{"9.9.9.9": {"a", "b"}, "1.2.3.4": {"c"}})
+	want := [][]string{{"1.2.3.4", "c"}, {"9.9.9.9", "a, b"}}
+	if !reflect.DeepEqual(r.rows, want) {
+		t.Fatalf("got rows %v, want %v", r.rows, want)
+	}
+}
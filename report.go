@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// report is a summary style output. the text, csv and markdown formats render it as a titled table,
+// json renders value as is so the json shape of each report stays the same whatever the table looks like.
+// key names the report in the json and csv documents
+type report struct {
+	key     string
+	title   string
+	columns []string
+	rows    [][]string
+	value   interface{}
+}
+
+// reporter writes reports to stdout in one -report-format. text and markdown write each report as it comes,
+// json and csv collect them and flush writes them as one document, so the output parses however many
+// reports the run made
+type reporter interface {
+	write(r report) error
+	flush() error
+}
+
+// newReporter returns the reporter for a -report-format
+func newReporter(format string) (reporter, error) {
+	switch format {
+	case "text":
+		return textReporter{}, nil
+	case "json":
+		return &jsonReporter{}, nil
+	case "csv":
+		return &csvReporter{}, nil
+	case "markdown":
+		return markdownReporter{}, nil
+	}
+	return nil, fmt.Errorf("unknown report format %s", format)
+}
+
+// textReporter writes a heading with the row count and an aligned table for people reading a terminal
+type textReporter struct{}
+
+func (textReporter) write(r report) error {
+	fmt.Printf("%s (%d):\n", r.title, len(r.rows))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  %s\n", strings.ToUpper(strings.Join(r.columns, "\t")))
+	for _, row := range r.rows {
+		fmt.Fprintf(tw, "  %s\n", strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (textReporter) flush() error {
+	return nil
+}
+
+// jsonReporter writes one indented json object with every report value under its key
+type jsonReporter struct {
+	reports []report
+}
+
+func (j *jsonReporter) write(r report) error {
+	j.reports = append(j.reports, r)
+	return nil
+}
+
+func (j *jsonReporter) flush() error {
+	if len(j.reports) == 0 {
+		return nil
+	}
+	values := map[string]interface{}{}
+	for _, r := range j.reports {
+		values[r.key] = r.value
+	}
+	j.reports = nil
+	return printJSON(values)
+}
+
+// csvReporter writes one table for all reports. the first column is the report key, then come the columns
+// of every report in the order they first appear, a row leaves the columns of other reports empty
+type csvReporter struct {
+	reports []report
+}
+
+func (c *csvReporter) write(r report) error {
+	c.reports = append(c.reports, r)
+	return nil
+}
+
+func (c *csvReporter) flush() error {
+	if len(c.reports) == 0 {
+		return nil
+	}
+	header := []string{"report"}
+	index := map[string]int{}
+	for _, r := range c.reports {
+		for _, column := range r.columns {
+			if _, ok := index[column]; !ok {
+				index[column] = len(header)
+				header = append(header, column)
+			}
+		}
+	}
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, r := range c.reports {
+		for _, row := range r.rows {
+			record := make([]string, len(header))
+			record[0] = r.key
+			for i, cell := range row {
+				record[index[r.columns[i]]] = cell
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	c.reports = nil
+	w.Flush()
+	return w.Error()
+}
+
+// markdownReporter writes a heading and a table that can be pasted into a report or a ticket
+type markdownReporter struct{}
+
+func (markdownReporter) write(r report) error {
+	fmt.Printf("### %s (%d)\n\n", r.title, len(r.rows))
+	fmt.Printf("| %s |\n", strings.Join(r.columns, " | "))
+	fmt.Printf("|%s\n", strings.Repeat(" --- |", len(r.columns)))
+	for _, row := range r.rows {
+		cells := []string{}
+		for _, c := range row {
+			cells = append(cells, strings.ReplaceAll(c, "|", "\\|"))
+		}
+		fmt.Printf("| %s |\n", strings.Join(cells, " | "))
+	}
+	fmt.Println()
+	return nil
+}
+
+func (markdownReporter) flush() error {
+	return nil
+}
+
+// newAssets is the set of hosts and netblocks that an import creates, as opposed to ones that already existed and were only updated
+type newAssets struct {
+	Hosts     []string `json:"hosts"`
+	Netblocks []string `json:"netblocks"`
+}
+
+// findNewAssets compares the outgoing project against what was exported from lair before the import
+func findNewAssets(existingHosts []lair.Host, existingNetblocks []lair.Netblock, project *lair.Project) newAssets {
+	assets := newAssets{Hosts: []string{}, Netblocks: []string{}}
+	seen := map[string]bool{}
+	for _, h := range existingHosts {
+		seen[h.IPv4] = true
+	}
+	for _, h := range project.Hosts {
+		if !seen[h.IPv4] {
+			seen[h.IPv4] = true
+			assets.Hosts = append(assets.Hosts, h.IPv4)
+		}
+	}
+	seen = map[string]bool{}
+	for _, n := range existingNetblocks {
+		seen[n.CIDR] = true
+	}
+	for _, n := range project.Netblocks {
+		if !seen[n.CIDR] {
+			seen[n.CIDR] = true
+			assets.Netblocks = append(assets.Netblocks, n.CIDR)
+		}
+	}
+	sort.Strings(assets.Hosts)
+	sort.Strings(assets.Netblocks)
+	return assets
+}
+
+// changeSchemaVersion is the version of the -report-diff-json layout. it goes up whenever a field changes
+// meaning or goes away, new fields can be added without a bump
+const changeSchemaVersion = 1
+
+// changeReport is the -report-diff-json output, what an import changed in lair for dashboards to consume.
+// it is the machine readable counterpart of -verbose-diff-hosts and -only-new
+type changeReport struct {
+	SchemaVersion  int                 `json:"schemaVersion"`
+	ProjectID      string              `json:"projectId"`
+	AddedHosts     []string            `json:"addedHosts"`
+	AddedHostnames map[string][]string `json:"addedHostnames"`
+	AddedNetblocks []string            `json:"addedNetblocks"`
+	Skipped        changeSkipped       `json:"skipped"`
+}
+
+// changeSkipped is what the results had that the import left out, hosts that weren't in lair without
+// -force-hosts (or over -hostname-limit-total) and netblocks that weren't added with -safe-netblocks
+type changeSkipped struct {
+	Hosts     []string `json:"hosts"`
+	Netblocks []string `json:"netblocks"`
+}
+
+// findChanges builds the -report-diff-json report. before is the hostnames every host had before the merge,
+// candidateHosts and candidateNetblocks are every IP and CIDR from the results that lair didn't have yet
+func findChanges(projectID string, before map[string][]string, existing, project *lair.Project, candidateHosts, candidateNetblocks []string) changeReport {
+	assets := findNewAssets(existing.Hosts, existing.Netblocks, project)
+	c := changeReport{
+		SchemaVersion:  changeSchemaVersion,
+		ProjectID:      projectID,
+		AddedHosts:     assets.Hosts,
+		AddedHostnames: map[string][]string{},
+		AddedNetblocks: assets.Netblocks,
+		Skipped:        changeSkipped{Hosts: []string{}, Netblocks: []string{}},
+	}
+	hosts := map[string]bool{}
+	for _, h := range project.Hosts {
+		hosts[h.IPv4] = true
+		had := map[string]bool{}
+		for _, name := range before[h.IPv4] {
+			had[strings.ToLower(name)] = true
+		}
+		for _, name := range h.Hostnames {
+			if key := strings.ToLower(name); !had[key] {
+				had[key] = true
+				c.AddedHostnames[h.IPv4] = append(c.AddedHostnames[h.IPv4], name)
+			}
+		}
+	}
+	netblocks := map[string]bool{}
+	for _, n := range project.Netblocks {
+		netblocks[n.CIDR] = true
+	}
+	for _, ip := range candidateHosts {
+		if !hosts[ip] {
+			c.Skipped.Hosts = append(c.Skipped.Hosts, ip)
+		}
+	}
+	for _, cidr := range candidateNetblocks {
+		if !netblocks[cidr] {
+			c.Skipped.Netblocks = append(c.Skipped.Netblocks, cidr)
+		}
+	}
+	sort.Strings(c.Skipped.Hosts)
+	sort.Strings(c.Skipped.Netblocks)
+	return c
+}
+
+// writeChangeReport writes the -report-diff-json report
+func writeChangeReport(filename string, c changeReport) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// newAssetsReport is the -only-new report
+func newAssetsReport(assets newAssets) report {
+	r := report{key: "newAssets", title: "New assets", columns: []string{"type", "asset"}, value: assets}
+	for _, h := range assets.Hosts {
+		r.rows = append(r.rows, []string{"host", h})
+	}
+	for _, n := range assets.Netblocks {
+		r.rows = append(r.rows, []string{"netblock", n})
+	}
+	return r
+}
+
+// notFoundReport lists the IPs or CIDRs of the results that lair had no host or netblock for, with the names
+// of the results that had them
+func notFoundReport(key, title, column string, notFound map[string][]string) report {
+	keys := []string{}
+	for k := range notFound {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	r := report{key: key, title: title, columns: []string{column, "names"}, value: notFound}
+	for _, k := range keys {
+		r.rows = append(r.rows, []string{k, strings.Join(notFound[k], ", ")})
+	}
+	return r
+}
+
+// domainCount is a row of the -show-scope-summary, how many results were discovered under a root domain
+type domainCount struct {
+	Domain string `json:"domain"`
+	Count  int    `json:"count"`
+}
+
+// summarizeDomains counts the results per root domain, sorted by count and then by name
+func summarizeDomains(results []amassResult) []domainCount {
+	counts := map[string]int{}
+	for _, r := range results {
+		domain := r.Domain
+		if domain == "" {
+			domain = "(none)"
+		}
+		counts[domain]++
+	}
+	summary := []domainCount{}
+	for domain, count := range counts {
+		summary = append(summary, domainCount{Domain: domain, Count: count})
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Count != summary[j].Count {
+			return summary[i].Count > summary[j].Count
+		}
+		return summary[i].Domain < summary[j].Domain
+	})
+	return summary
+}
+
+// scopeReport is the -show-scope-summary report, so analysts can sanity check scope before importing
+func scopeReport(summary []domainCount) report {
+	r := report{key: "scopeSummary", title: "Discovered domains", columns: []string{"domain", "count"}, value: summary}
+	for _, d := range summary {
+		r.rows = append(r.rows, []string{d.Domain, strconv.Itoa(d.Count)})
+	}
+	return r
+}
+
+// asnSummary is a row of the -summary-by-asn table
+type asnSummary struct {
+	ASN          asnNumber `json:"asn"`
+	Descriptions []string  `json:"descriptions"`
+	Netblocks    []string  `json:"netblocks"`
+	Addresses    int       `json:"addresses"`
+}
+
+// summarizeASNs groups the discovered netblocks by ASN, sorted by how many netblocks each has
+func summarizeASNs(results []amassResult) []asnSummary {
+	byASN := map[asnNumber]*asnSummary{}
+	seen := map[string]bool{}
+	for _, r := range results {
+		for _, a := range r.Addresses {
+			s, ok := byASN[a.Asn]
+			if !ok {
+				s = &asnSummary{ASN: a.Asn, Descriptions: []string{}, Netblocks: []string{}}
+				byASN[a.Asn] = s
+			}
+			if a.Desc != "" {
+				s.Descriptions = appendUnique(s.Descriptions, a.Desc)
+			}
+			if a.Cidr != "" {
+				s.Netblocks = appendUnique(s.Netblocks, a.Cidr)
+			}
+			if key := fmt.Sprintf("%s|%s", a.Asn, a.IP); !seen[key] {
+				seen[key] = true
+				s.Addresses++
+			}
+		}
+	}
+	summary := []asnSummary{}
+	for _, s := range byASN {
+		sort.Strings(s.Netblocks)
+		summary = append(summary, *s)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if len(summary[i].Netblocks) != len(summary[j].Netblocks) {
+			return len(summary[i].Netblocks) > len(summary[j].Netblocks)
+		}
+		return summary[i].ASN.less(summary[j].ASN)
+	})
+	return summary
+}
+
+// asnReport is the -summary-by-asn report
+func asnReport(summary []asnSummary) report {
+	r := report{key: "asnSummary", title: "Netblocks by ASN", columns: []string{"asn", "netblocks", "addresses", "description"}, value: summary}
+	for _, s := range summary {
+		r.rows = append(r.rows, []string{s.ASN.String(), strconv.Itoa(len(s.Netblocks)), strconv.Itoa(s.Addresses), strings.Join(s.Descriptions, "; ")})
+	}
+	return r
+}
+
+// timeline units for -timeline, with the layout a bucket is labelled with
+var timelineUnits = map[string]string{
+	"hour": "2006-01-02 15:00",
+	"day":  "2006-01-02",
+}
+
+// timelineBucket is a row of the -timeline histogram, Start is the UTC hour or day
+type timelineBucket struct {
+	Start   string `json:"start"`
+	Results int    `json:"results"`
+}
+
+// timeline is the -timeline summary, results without a (parseable) timestamp are only counted
+type timeline struct {
+	Buckets          []timelineBucket `json:"buckets"`
+	WithoutTimestamp int              `json:"withoutTimestamp"`
+}
+
+// summarizeTimeline counts the results discovered in every UTC hour or day, oldest first.
+// hours and days nothing was discovered in are left out
+func summarizeTimeline(results []amassResult, unit string) timeline {
+	layout := timelineUnits[unit]
+	counts := map[string]int{}
+	t := timeline{Buckets: []timelineBucket{}}
+	for _, r := range results {
+		discovered, ok := r.discovered()
+		if !ok {
+			t.WithoutTimestamp++
+			continue
+		}
+		// the layouts sort the same as the times they stand for
+		counts[discovered.UTC().Format(layout)]++
+	}
+	for start, n := range counts {
+		t.Buckets = append(t.Buckets, timelineBucket{Start: start, Results: n})
+	}
+	sort.Slice(t.Buckets, func(i, j int) bool {
+		return t.Buckets[i].Start < t.Buckets[j].Start
+	})
+	return t
+}
+
+// timelineReport is the -timeline report, the histogram bars are scaled to the busiest bucket
+func timelineReport(t timeline) report {
+	r := report{key: "timeline", title: "Discovery timeline (UTC)", columns: []string{"start", "results", "histogram"}, value: t}
+	busiest := 0
+	for _, b := range t.Buckets {
+		if b.Results > busiest {
+			busiest = b.Results
+		}
+	}
+	for _, b := range t.Buckets {
+		bar := strings.Repeat("#", (b.Results*40+busiest-1)/busiest)
+		r.rows = append(r.rows, []string{b.Start, strconv.Itoa(b.Results), bar})
+	}
+	if t.WithoutTimestamp > 0 {
+		r.rows = append(r.rows, []string{"(no timestamp)", strconv.Itoa(t.WithoutTimestamp), ""})
+	}
+	return r
+}
+
+// printJSON writes v to stdout as indented json
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
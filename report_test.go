@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// captureStdout returns what f printed to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		out <- data
+	}()
+	f()
+	w.Close()
+	return string(<-out)
+}
+
+// testReports are two reports with different columns, like a run with -only-new that also had hosts lair didn't
+func testReports() []report {
+	return []report{
+		newAssetsReport(newAssets{Hosts: []string{"9.9.9.9"}, Netblocks: []string{}}),
+		notFoundReport("hostsNotFound", "Hosts not in lair", "ip", map[string][]string{"9.9.9.9": {"api.example.com"}, "8.8.8.8": {"a.example.com", "b.example.com"}}),
+	}
+}
+
+func TestJSONReporterWritesOneDocument(t *testing.T) {
+	reports, err := newReporter("json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := captureStdout(t, func() {
+		for _, r := range testReports() {
+			if err := reports.write(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := reports.flush(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var doc struct {
+		NewAssets     newAssets           `json:"newAssets"`
+		HostsNotFound map[string][]string `json:"hostsNotFound"`
+	}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("output is not one json document: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(doc.NewAssets.Hosts, []string{"9.9.9.9"}) || len(doc.HostsNotFound) != 2 {
+		t.Errorf("got %+v", doc)
+	}
+}
+
+func TestCSVReporterWritesOneTable(t *testing.T) {
+	reports, err := newReporter("csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := captureStdout(t, func() {
+		for _, r := range testReports() {
+			if err := reports.write(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := reports.flush(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not one csv table: %v\n%s", err, out)
+	}
+	want := [][]string{
+		{"report", "type", "asset", "ip", "names"},
+		{"newAssets", "host", "9.9.9.9", "", ""},
+		{"hostsNotFound", "", "", "8.8.8.8", "a.example.com, b.example.com"},
+		{"hostsNotFound", "", "", "9.9.9.9", "api.example.com"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %q, want %q", rows, want)
+	}
+}
+
+func TestReporterFlushWithoutReports(t *testing.T) {
+	for _, format := range []string{"text", "json", "csv", "markdown"} {
+		reports, err := newReporter(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := captureStdout(t, func() { reports.flush() }); out != "" {
+			t.Errorf("%s printed %q without any reports", format, out)
+		}
+	}
+}
+
+func TestRunReportsAsOneJSONDocument(t *testing.T) {
+	project := lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}}}
+	opts := testOptions()
+	opts.reportFormat = "json"
+	opts.onlyNew = true
+	opts.showScope = true
+	out := captureStdout(t, func() {
+		runImport(t, opts, project,
+			`{"name":"www.example.com","domain":"example.com","addresses":[{"ip":"1.2.3.4"}]}`,
+			`{"name":"api.example.com","domain":"example.com","addresses":[{"ip":"9.9.9.9"}]}`,
+		)
+	})
+	doc := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("stdout is not one json document: %v\n%s", err, out)
+	}
+	for _, key := range []string{"scopeSummary", "hostsNotFound", "newAssets"} {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("the document has no %s: %s", key, out)
+		}
+	}
+	notFound := map[string][]string{}
+	if err := json.Unmarshal(doc["hostsNotFound"], &notFound); err != nil || !reflect.DeepEqual(notFound, map[string][]string{"9.9.9.9": {"api.example.com"}}) {
+		t.Errorf("got hostsNotFound %s", doc["hostsNotFound"])
+	}
+
+}
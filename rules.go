@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// transformer is a post-parse hook, it gets every result before it is merged into the project
+// and returns the (possibly modified) result, or false to drop it
+type transformer interface {
+	transform(result amassResult) (amassResult, bool)
+}
+
+// ruleConfig is one entry of the -rules file
+type ruleConfig struct {
+	Action      string `json:"action"`
+	Field       string `json:"field"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// regexRule is a transformer that either rewrites a field with a regex replace or drops whatever matches.
+// name, domain, tag and source are result fields, dropping on them drops the whole result.
+// ip, cidr and desc are address fields, dropping on them only removes the matching addresses.
+type regexRule struct {
+	action      string
+	field       string
+	re          *regexp.Regexp
+	replacement string
+}
+
+var resultFields = map[string]bool{"name": true, "domain": true, "tag": true, "source": true}
+var addressFields = map[string]bool{"ip": true, "cidr": true, "desc": true}
+
+// loadRules reads a json array of rules and compiles it into a transformation pipeline
+func loadRules(filename string) ([]transformer, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var configs []ruleConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+	pipeline := []transformer{}
+	for i, c := range configs {
+		rule, err := newRegexRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		pipeline = append(pipeline, rule)
+	}
+	return pipeline, nil
+}
+
+func newRegexRule(c ruleConfig) (*regexRule, error) {
+	if c.Action != "replace" && c.Action != "drop" {
+		return nil, fmt.Errorf("unknown action %q", c.Action)
+	}
+	if !resultFields[c.Field] && !addressFields[c.Field] {
+		return nil, fmt.Errorf("unknown field %q", c.Field)
+	}
+	re, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &regexRule{action: c.Action, field: c.Field, re: re, replacement: c.Replacement}, nil
+}
+
+// sedGroup matches the \1 style group references of sed replacements
+var sedGroup = regexp.MustCompile(`\\([0-9])`)
+
+// parseRewrite compiles a -hostname-rewrite rule, written like sed's s/pattern/replacement/flags, into a name
+// replace rule. any character can be the delimiter and is escaped with a backslash inside the rule. groups are
+// referenced as \1 or $1, every match is replaced (sed's g flag is implied) and the i flag ignores case
+func parseRewrite(expr string) (*regexRule, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return nil, fmt.Errorf("%q is not an s/pattern/replacement/ rule", expr)
+	}
+	delim := expr[1:2]
+	parts := []string{}
+	current := ""
+	rest := expr[2:]
+	for i := 0; i < len(rest); i++ {
+		switch {
+		case rest[i] == '\\' && i+1 < len(rest) && rest[i+1:i+2] == delim:
+			current += delim
+			i++
+		case rest[i:i+1] == delim:
+			parts = append(parts, current)
+			current = ""
+		default:
+			current += rest[i : i+1]
+		}
+	}
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%q is not an s/pattern/replacement/ rule", expr)
+	}
+	pattern, flags := parts[0], current
+	for _, f := range flags {
+		switch f {
+		case 'g':
+		case 'i':
+			pattern = "(?i)" + pattern
+		default:
+			return nil, fmt.Errorf("%q has unknown flag %q", expr, f)
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", expr, err)
+	}
+	replacement := sedGroup.ReplaceAllString(parts[1], "$${$1}")
+	return &regexRule{action: "replace", field: "name", re: re, replacement: replacement}, nil
+}
+
+func (r *regexRule) transform(result amassResult) (amassResult, bool) {
+	if resultFields[r.field] {
+		value := r.resultField(&result)
+		if r.action == "drop" {
+			return result, !r.re.MatchString(*value)
+		}
+		if r.field == "source" && len(result.Sources) > 0 {
+			// schema v3 results keep their sources in a list, Source is only the joined form of it
+			sources := []string{}
+			for _, source := range result.Sources {
+				if source = r.re.ReplaceAllString(source, r.replacement); source != "" {
+					sources = append(sources, source)
+				}
+			}
+			result.Sources = sources
+			result.Source = strings.Join(sources, ",")
+			return result, true
+		}
+		*value = r.re.ReplaceAllString(*value, r.replacement)
+		return result, true
+	}
+	addresses := []amassAddress{}
+	for _, address := range result.Addresses {
+		value := r.addressField(&address)
+		if r.action == "drop" {
+			if r.re.MatchString(*value) {
+				continue
+			}
+		} else {
+			*value = r.re.ReplaceAllString(*value, r.replacement)
+		}
+		addresses = append(addresses, address)
+	}
+	result.Addresses = addresses
+	return result, true
+}
+
+func (r *regexRule) resultField(result *amassResult) *string {
+	switch r.field {
+	case "domain":
+		return &result.Domain
+	case "tag":
+		return &result.Tag
+	case "source":
+		return &result.Source
+	}
+	return &result.Name
+}
+
+func (r *regexRule) addressField(address *amassAddress) *string {
+	switch r.field {
+	case "cidr":
+		return &address.Cidr
+	case "desc":
+		return &address.Desc
+	}
+	return &address.IP
+}
+
+// applyTransforms runs every result through the pipeline in order, dropping results that any step rejects
+func applyTransforms(results []amassResult, pipeline []transformer) []amassResult {
+	if len(pipeline) == 0 {
+		return results
+	}
+	kept := []amassResult{}
+	for _, result := range results {
+		keep := true
+		for _, t := range pipeline {
+			if result, keep = t.transform(result); !keep {
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyTransforms(t *testing.T) {
+	pipeline := []transformer{}
+	for _, c := range []ruleConfig{
+		{Action: "replace", Field: "name", Pattern: `\.corp\.example\.com$`, Replacement: ".example.com"},
+		{Action: "drop", Field: "name", Pattern: `^internal\.`},
+		{Action: "drop", Field: "ip", Pattern: `^10\.`},
+	} {
+		rule, err := newRegexRule(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pipeline = append(pipeline, rule)
+	}
+	results := []amassResult{
+		{Name: "www.corp.example.com", Addresses: []amassAddress{{IP: "1.2.3.4"}, {IP: "10.0.0.1"}}},
+		{Name: "internal.example.com", Addresses: []amassAddress{{IP: "5.6.7.8"}}},
+		{Name: "api.example.com", Addresses: []amassAddress{{IP: "10.0.0.2"}}},
+	}
+	got := applyTransforms(results, pipeline)
+	// a result whose addresses are all dropped is still kept, it just matches nothing
+	want := []amassResult{
+		{Name: "www.example.com", Addresses: []amassAddress{{IP: "1.2.3.4"}}},
+		{Name: "api.example.com", Addresses: []amassAddress{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := map[string]bool{
+		`[{"action":"replace","field":"desc","pattern":"\\s+","replacement":" "}]`: true,
+		`[{"action":"rename","field":"name","pattern":"x"}]`:                       false,
+		`[{"action":"drop","field":"asn","pattern":"x"}]`:                          false,
+		`[{"action":"drop","field":"name","pattern":"("}]`:                         false,
+		`{"action":"drop"}`: false,
+	}
+	dir := t.TempDir()
+	for rules, ok := range tests {
+		filename := filepath.Join(dir, "rules.json")
+		if err := ioutil.WriteFile(filename, []byte(rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pipeline, err := loadRules(filename)
+		if ok && (err != nil || len(pipeline) != 1) {
+			t.Errorf("%s: got %d rules and error %v", rules, len(pipeline), err)
+		}
+		if !ok && err == nil {
+			t.Errorf("%s: expected an error", rules)
+		}
+	}
+}
+
+func TestParseRewrite(t *testing.T) {
+	tests := []struct {
+		rule, name, want string
+	}{
+		{`s/^ip-([0-9]+)-([0-9]+)\.vendor\.net$/vendor-\1-\2.example.com/`, "ip-10-20.vendor.net", "vendor-10-20.example.com"},
+		{`s/^(.*)\.old\.example\.com$/${1}.example.com/`, "www.old.example.com", "www.example.com"},
+		{`s/-/./`, "a-b-c.example.com", "a.b.c.example.com"},
+		{`s/\.CORP\./.internal./i`, "db.corp.example.com", "db.internal.example.com"},
+		{`s|/|\||`, "a/b", "a|b"},
+		{`s#\##-#`, "a#b", "a-b"},
+		{`s/nomatch//`, "www.example.com", "www.example.com"},
+	}
+	for _, tt := range tests {
+		rule, err := parseRewrite(tt.rule)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.rule, err)
+			continue
+		}
+		if got, _ := rule.transform(amassResult{Name: tt.name}); got.Name != tt.want {
+			t.Errorf("%s on %s: got %s, want %s", tt.rule, tt.name, got.Name, tt.want)
+		}
+	}
+}
+
+func TestParseRewriteInvalid(t *testing.T) {
+	for _, rule := range []string{"", "s", "x/a/b/", "s/a/b", "s/a/b/c/", "s/a/b/x", "s/(/b/"} {
+		if _, err := parseRewrite(rule); err == nil {
+			t.Errorf("%q: expected an error", rule)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// runTagPrefix starts the -tag-run-id tag, lair's tag filter on run:<id> finds everything one run touched
+const runTagPrefix = "run:"
+
+// newRunID is a run id for when -run-id isn't given, the start time followed by a few random hex digits so
+// runs started in the same second still differ, e.g. 2024-06-01T12:00:00Z-a3f9
+func newRunID(started time.Time) (string, error) {
+	suffix := make([]byte, 2)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return started.UTC().Format(time.RFC3339) + "-" + hex.EncodeToString(suffix), nil
+}
+
+// checkRunID rejects a -run-id that can't be used as a lair tag
+func checkRunID(id string) error {
+	if strings.TrimSpace(id) == "" {
+		return fmt.Errorf("the run id is empty")
+	}
+	if strings.ContainsAny(id, ", \t\n") {
+		return fmt.Errorf("the run id %q has commas or whitespace in it", id)
+	}
+	return nil
+}
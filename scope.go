@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+)
+
+// scope is the -scope-file, the domains and networks an engagement is allowed to touch
+type scope struct {
+	domains  []string
+	networks []*net.IPNet
+}
+
+// loadScope reads a scope file, one domain, CIDR or IP per line. # starts a comment
+func loadScope(filename string) (scope, error) {
+	var s scope
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return s, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+		if line == "" {
+			continue
+		}
+		if ip := net.ParseIP(line); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			s.networks = append(s.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if strings.Contains(line, "/") {
+			_, network, err := net.ParseCIDR(line)
+			if err != nil {
+				return s, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			s.networks = append(s.networks, network)
+			continue
+		}
+		s.domains = append(s.domains, line)
+	}
+	if len(s.domains) == 0 && len(s.networks) == 0 {
+		return s, fmt.Errorf("%s has no domains or networks", filename)
+	}
+	return s, nil
+}
+
+// violation returns why the result is out of scope, or "" if it is in scope. when the scope has domains the
+// name has to be under one of them, when it has networks every address has to be in one of them
+func (s scope) violation(r amassResult) string {
+	if len(s.domains) > 0 {
+		in := false
+		for _, d := range s.domains {
+			if hasDomainSuffix(r.Name, d) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return "name outside scope"
+		}
+	}
+	if len(s.networks) > 0 {
+		for _, a := range r.Addresses {
+			ip := net.ParseIP(a.IP)
+			if ip == nil || !inNetworks(s.networks, ip) {
+				return fmt.Sprintf("address %s outside scope", a.IP)
+			}
+		}
+	}
+	return ""
+}
+
+// outOfScope splits the results into the ones in scope and the ones that aren't, with the reason for each
+func outOfScope(results []amassResult, s scope) ([]amassResult, []unmatchedResult) {
+	kept := []amassResult{}
+	violations := []unmatchedResult{}
+	for _, r := range results {
+		if reason := s.violation(r); reason != "" {
+			violations = append(violations, unmatchedResult{amassResult: r, Reason: reason})
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept, violations
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lair-framework/go-lair"
+)
+
+// writeScope writes a -scope-file and returns its name
+func writeScope(t *testing.T, lines ...string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "scope.txt")
+	if err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestScopeViolation(t *testing.T) {
+	s, err := loadScope(writeScope(t, "# engagement 42", "example.com", "1.2.3.0/24", "5.6.7.8 # the mail relay", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		result amassResult
+		want   string
+	}{
+		{amassResult{Name: "www.example.com", Addresses: []amassAddress{{IP: "1.2.3.4"}, {IP: "5.6.7.8"}}}, ""},
+		{amassResult{Name: "example.com"}, ""},
+		{amassResult{Name: "notexample.com", Addresses: []amassAddress{{IP: "1.2.3.4"}}}, "name outside scope"},
+		{amassResult{Name: "www.example.com", Addresses: []amassAddress{{IP: "1.2.3.4"}, {IP: "5.6.7.9"}}}, "address 5.6.7.9 outside scope"},
+	}
+	for _, tt := range tests {
+		if got := s.violation(tt.result); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.result.Name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadScopeInvalid(t *testing.T) {
+	for _, lines := range [][]string{{"# nothing"}, {"example.com", "1.2.3.0/33"}} {
+		if _, err := loadScope(writeScope(t, lines...)); err == nil {
+			t.Errorf("%q: expected an error", lines)
+		}
+	}
+}
+
+func TestRunAbortOnScopeViolation(t *testing.T) {
+	project := lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4"}}}
+	s, imports := lairServer(t, project, "Ok")
+	t.Setenv("LAIR_API_SERVER", withCredentials(s.URL))
+	filename := filepath.Join(t.TempDir(), "amass.json")
+	results := `{"name":"www.example.com","addresses":[{"ip":"1.2.3.4"}]}` + "\n" +
+		`{"name":"www.example.org","addresses":[{"ip":"1.2.3.4"}]}`
+	if err := ioutil.WriteFile(filename, []byte(results), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	opts.scopeFile = writeScope(t, "example.com")
+	opts.abortOnScope = true
+	opts.scopeReport = filepath.Join(t.TempDir(), "violations.json")
+	if err := run(opts, []string{"p1", filename}); err == nil || !strings.Contains(err.Error(), "1 results are out of scope") {
+		t.Fatalf("got %v, want the run aborted over the out of scope result", err)
+	}
+	if len(*imports) != 0 {
+		t.Fatalf("got %d imports after the scope violation", len(*imports))
+	}
+	data, err := ioutil.ReadFile(opts.scopeReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var violations []unmatchedResult
+	if err := json.Unmarshal(data, &violations); err != nil {
+		t.Fatalf("the scope report isn't json: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Name != "www.example.org" || violations[0].Reason != "name outside scope" {
+		t.Errorf("the scope report has %+v", violations)
+	}
+
+	// without the abort the result is only dropped
+	opts.abortOnScope = false
+	if err := run(opts, []string{"p1", filename}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if hostnames := (*imports)[0].Hosts[0].Hostnames; len(hostnames) != 1 || hostnames[0] != "www.example.com" {
+		t.Errorf("imported hostnames %v, want only the one in scope", hostnames)
+	}
+}
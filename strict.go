@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// jsonFields are the json names of the fields of a struct, the ones the decoder fills in
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// unknownFields is the -strict-json check. like json.Decoder's DisallowUnknownFields, but it looks at the whole
+// file instead of stopping at the first field: it returns every field of the results (and their addresses) that
+// drone-amass doesn't read, with how many lines have it. lines that don't decode are left to the parser to report
+func unknownFields(data []byte) map[string]int {
+	resultFields := jsonFields(reflect.TypeOf(amassResult{}))
+	addressFields := jsonFields(reflect.TypeOf(amassAddress{}))
+	unknown := map[string]int{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for name, value := range fields {
+			if !resultFields[name] {
+				seen[name] = true
+				continue
+			}
+			if name != "addresses" {
+				continue
+			}
+			var addresses []map[string]json.RawMessage
+			if err := json.Unmarshal(value, &addresses); err != nil {
+				continue
+			}
+			for _, a := range addresses {
+				for field := range a {
+					if !addressFields[field] {
+						seen["addresses."+field] = true
+					}
+				}
+			}
+		}
+		for name := range seen {
+			unknown[name]++
+		}
+	}
+	return unknown
+}
+
+// describeFields lists the unknown fields with their line counts, in name order
+func describeFields(unknown map[string]int) string {
+	names := []string{}
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	described := []string{}
+	for _, name := range names {
+		described = append(described, fmt.Sprintf("%s (%d lines)", name, unknown[name]))
+	}
+	return strings.Join(described, ", ")
+}
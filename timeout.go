@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lair-framework/api-server/client"
+	"github.com/lair-framework/go-lair"
+)
+
+// errRequestTimeout is returned for a lair API call that still took longer than -request-timeout on its last try
+var errRequestTimeout = errors.New("lair API request timed out")
+
+// retryClient retries the lair API calls that ran out of -request-timeout, so one slow request doesn't fail
+// the whole run. the deadline itself is on the http client newLairClient builds, which cancels the request
+type retryClient struct {
+	api     lairAPI
+	timeout time.Duration
+	retries int
+}
+
+// withRetries wraps api in a retryClient, a timeout of 0 means requests never time out so there is nothing to retry
+func withRetries(api lairAPI, timeout time.Duration, retries int) lairAPI {
+	if timeout <= 0 {
+		return api
+	}
+	return &retryClient{api: api, timeout: timeout, retries: retries}
+}
+
+// isTimeout reports whether err is a request that ran out of time
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retry runs call until it doesn't time out, at most retries more times. other errors are returned right away.
+// before each retry, landed is asked whether the call went through after all, nil means it didn't
+func (c *retryClient) retry(call func() error, landed func() bool) error {
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			if landed != nil && landed() {
+				return nil
+			}
+			warnf("Lair API request timed out after %s, retrying (%d of %d)", c.timeout, attempt, c.retries)
+		}
+		if err = call(); !isTimeout(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w after %d attempts: %v", errRequestTimeout, c.retries+1, err)
+}
+
+func (c *retryClient) ExportProject(id string) (lair.Project, error) {
+	var project lair.Project
+	err := c.retry(func() error {
+		var err error
+		project, err = c.api.ExportProject(id)
+		return err
+	}, nil)
+	return project, err
+}
+
+// ImportProject retries an import that timed out only once an export shows it didn't land. the server may
+// have applied it before the deadline cancelled the request, and sending it again would merge its notes twice
+func (c *retryClient) ImportProject(o *client.DOptions, p *lair.Project) (*http.Response, error) {
+	var res *http.Response
+	landed := false
+	err := c.retry(func() error {
+		var err error
+		res, err = c.api.ImportProject(o, p)
+		return err
+	}, func() bool {
+		exported, err := c.api.ExportProject(p.ID)
+		landed = err == nil && importLanded(p, exported)
+		return landed
+	})
+	if landed {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"Status":"Ok","Message":""}`)),
+		}, nil
+	}
+	return res, err
+}
+
+// importLanded reports whether everything p carries is in the exported project: every netblock, and every
+// host with all of its hostnames
+func importLanded(p *lair.Project, exported lair.Project) bool {
+	netblocks := map[string]bool{}
+	for _, n := range exported.Netblocks {
+		netblocks[n.CIDR] = true
+	}
+	for _, n := range p.Netblocks {
+		if !netblocks[n.CIDR] {
+			return false
+		}
+	}
+	hosts := map[string][]string{}
+	for _, h := range exported.Hosts {
+		hosts[h.IPv4] = h.Hostnames
+	}
+	for _, h := range p.Hosts {
+		hostnames, ok := hosts[h.IPv4]
+		if !ok {
+			return false
+		}
+		for _, name := range h.Hostnames {
+			if !contains(hostnames, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lair-framework/api-server/client"
+	"github.com/lair-framework/go-lair"
+)
+
+// testRequestTimeout is the -request-timeout of these tests, a slow request takes ten times as long
+const testRequestTimeout = 50 * time.Millisecond
+
+// slowLair is a lair API server that answers the first slow requests (exports and imports alike) only after
+// the client gave up. an import is applied before the wait when apply is set, like a server that got the
+// whole request but was slow to answer
+type slowLair struct {
+	mu       sync.Mutex
+	slow     int
+	apply    bool
+	requests int
+	project  lair.Project
+	imports  int
+}
+
+func (s *slowLair) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	slow := s.requests <= s.slow
+	if r.Method != http.MethodGet && (!slow || s.apply) {
+		var p lair.Project
+		json.NewDecoder(r.Body).Decode(&p)
+		s.project.Hosts = append(s.project.Hosts, p.Hosts...)
+		s.imports++
+	}
+	project := s.project
+	s.mu.Unlock()
+	if slow {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * testRequestTimeout):
+		}
+		return
+	}
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(project)
+		return
+	}
+	w.Write([]byte(`{"Status":"Ok","Message":""}`))
+}
+
+// counts returns how many requests and imports the server got
+func (s *slowLair) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.imports
+}
+
+// slowClient is the client run builds for a -request-timeout against s
+func slowClient(t *testing.T, s *slowLair, retries int) lairAPI {
+	t.Helper()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	c, err := newLairClient(withCredentials(server.URL), false, nil, testRequestTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return withRetries(c, testRequestTimeout, retries)
+}
+
+func TestRetryClientRetriesSlowExport(t *testing.T) {
+	s := &slowLair{slow: 1, project: lair.Project{ID: "p1"}}
+	project, err := slowClient(t, s, 2).ExportProject("p1")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if requests, _ := s.counts(); project.ID != "p1" || requests != 2 {
+		t.Errorf("got project %q after %d requests, want p1 after 2", project.ID, requests)
+	}
+}
+
+func TestRetryClientGivesUp(t *testing.T) {
+	s := &slowLair{slow: 3}
+	_, err := slowClient(t, s, 1).ExportProject("p1")
+	if !errors.Is(err, errRequestTimeout) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if requests, _ := s.counts(); requests != 2 {
+		t.Errorf("got %d requests, want the first try and one retry", requests)
+	}
+}
+
+func TestRetryClientResendsImportThatDidNotLand(t *testing.T) {
+	s := &slowLair{slow: 1, project: lair.Project{ID: "p1"}}
+	p := &lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4", Hostnames: []string{"www.example.com"}}}}
+	res, err := slowClient(t, s, 2).ImportProject(&client.DOptions{}, p)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	// the slow import, the export that shows it didn't land and the import sent again
+	if requests, imports := s.counts(); requests != 3 || imports != 1 || string(body) != `{"Status":"Ok","Message":""}` {
+		t.Errorf("got %d requests, %d imports and response %s", requests, imports, body)
+	}
+}
+
+func TestRetryClientDoesNotResendImportThatLanded(t *testing.T) {
+	s := &slowLair{slow: 1, apply: true, project: lair.Project{ID: "p1"}}
+	p := &lair.Project{ID: "p1", Hosts: []lair.Host{{IPv4: "1.2.3.4", Hostnames: []string{"www.example.com"}}}}
+	res, err := slowClient(t, s, 2).ImportProject(&client.DOptions{}, p)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	res.Body.Close()
+	// the slow import and the export that shows it went through
+	if requests, imports := s.counts(); requests != 2 || imports != 1 {
+		t.Errorf("got %d requests and %d imports, want the import sent once", requests, imports)
+	}
+}
+
+func TestImportLanded(t *testing.T) {
+	exported := lair.Project{
+		Hosts:     []lair.Host{{IPv4: "1.2.3.4", Hostnames: []string{"old.example.com", "www.example.com"}}},
+		Netblocks: []lair.Netblock{{CIDR: "1.2.3.0/24"}},
+	}
+	tests := []struct {
+		p    lair.Project
+		want bool
+	}{
+		{lair.Project{Hosts: []lair.Host{{IPv4: "1.2.3.4", Hostnames: []string{"www.example.com"}}}}, true},
+		{lair.Project{Hosts: []lair.Host{{IPv4: "1.2.3.4", Hostnames: []string{"api.example.com"}}}}, false},
+		{lair.Project{Hosts: []lair.Host{{IPv4: "5.6.7.8"}}}, false},
+		{lair.Project{Netblocks: []lair.Netblock{{CIDR: "1.2.3.0/24"}}}, true},
+		{lair.Project{Netblocks: []lair.Netblock{{CIDR: "5.6.7.0/24"}}}, false},
+	}
+	for i, tt := range tests {
+		if got := importLanded(&tt.p, exported); got != tt.want {
+			t.Errorf("%d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
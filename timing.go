@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// phaseTiming is how long one phase of the run took
+type phaseTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// phaseTimer splits the run into consecutive phases for the -verbose timing summary. each mark ends the
+// current phase and starts the next one, so the phases always add up to the whole run
+type phaseTimer struct {
+	start  time.Time
+	last   time.Time
+	phases []phaseTiming
+}
+
+func newPhaseTimer(start time.Time) *phaseTimer {
+	return &phaseTimer{start: start, last: start}
+}
+
+// mark ends the phase that is running under the given name
+func (t *phaseTimer) mark(name string) {
+	t.phases = append(t.phases, phaseTiming{name: name, duration: time.Since(t.last)})
+	t.last = time.Now()
+}
+
+// print writes the time spent per phase and how many hosts and netblocks were processed per second
+func (t *phaseTimer) print(hosts, netblocks int) {
+	total := time.Since(t.start)
+	fmt.Println("Timing:")
+	for _, p := range t.phases {
+		fmt.Printf("  %-8s %s\n", p.name, p.duration.Round(time.Millisecond))
+	}
+	fmt.Printf("  %-8s %s\n", "total", total.Round(time.Millisecond))
+	if seconds := total.Seconds(); seconds > 0 {
+		fmt.Printf("  %.1f hosts/s, %.1f netblocks/s\n", float64(hosts)/seconds, float64(netblocks)/seconds)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxValidationErrors is how many decode errors -validate prints before only counting them
+const maxValidationErrors = 20
+
+// validation is what -validate found out about a results file
+type validation struct {
+	lines   int
+	results int
+	errors  []string
+	fields  map[string]int
+	schemas map[string]int
+}
+
+// schema returns the detected amass schema version of the file
+func (v *validation) schema() string {
+	switch len(v.schemas) {
+	case 0:
+		return "unknown"
+	case 1:
+		for s := range v.schemas {
+			return s
+		}
+	}
+	return "mixed"
+}
+
+// detectSchema tells the amass json schema versions apart by how sources are recorded,
+// v2 has a single "source" and v3 has a "sources" list
+func detectSchema(fields map[string]json.RawMessage) string {
+	if _, ok := fields["sources"]; ok {
+		return "v3"
+	}
+	if _, ok := fields["source"]; ok {
+		return "v2"
+	}
+	return ""
+}
+
+// validateData parses every line on its own, so one bad line doesn't hide problems further down the file.
+// lines only counts the lines with a result on them, blank lines and text comments are left out. with a
+// schemaVersion json lines are read like -schema-version reads them, a line in the other version is an error
+func validateData(data []byte, format, schemaVersion string) *validation {
+	v := &validation{fields: map[string]int{}, schemas: map[string]int{}}
+	if format == "db" {
+		return validateDB(v, data)
+	}
+	own, other := "source", "sources"
+	if schemaVersion == "3" {
+		own, other = other, own
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || (format == "text" && strings.HasPrefix(line, "#")) {
+			continue
+		}
+		v.lines++
+		var result amassResult
+		if format == "text" {
+			r, err := parseTextLine(line)
+			if err != nil {
+				v.errors = append(v.errors, fmt.Sprintf("line %d: %s", i+1, err.Error()))
+				continue
+			}
+			result = r
+			v.schemas["text"]++
+		} else {
+			fields := map[string]json.RawMessage{}
+			if err := json.Unmarshal([]byte(line), &fields); err != nil {
+				v.errors = append(v.errors, fmt.Sprintf("line %d: %s", i+1, err.Error()))
+				continue
+			}
+			if err := json.Unmarshal([]byte(line), &result); err != nil {
+				v.errors = append(v.errors, fmt.Sprintf("line %d: %s", i+1, err.Error()))
+				continue
+			}
+			if schemaVersion != "" {
+				_, hasOwn := fields[own]
+				if _, hasOther := fields[other]; hasOther && !hasOwn {
+					v.errors = append(v.errors, fmt.Sprintf("line %d: has %q, which is not amass schema %s as given with -schema-version", i+1, other, schemaVersion))
+					continue
+				}
+				if schemaVersion == "3" {
+					result.Source = ""
+				} else {
+					result.Sources = nil
+				}
+				v.schemas["v"+schemaVersion]++
+			} else if schema := detectSchema(fields); schema != "" {
+				v.schemas[schema]++
+			}
+			result.fillSources()
+		}
+		v.results++
+		v.count(result)
+	}
+	return v
+}
+
+// validateDB checks an amass db export, its rows only make results together so it is parsed as a whole
+func validateDB(v *validation, data []byte) *validation {
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			v.lines++
+		}
+	}
+	err := parseDBLines(data, func(r amassResult) bool {
+		v.results++
+		v.count(r)
+		return true
+	})
+	var bad lineErrors
+	if errors.As(err, &bad) {
+		for _, e := range bad {
+			v.errors = append(v.errors, e.Error())
+		}
+	}
+	if v.results > 0 {
+		v.schemas["db"] = v.results
+	}
+	return v
+}
+
+// count records which fields of a result are populated
+func (v *validation) count(r amassResult) {
+	populated := map[string]bool{
+		"name":      r.Name != "",
+		"domain":    r.Domain != "",
+		"addresses": len(r.Addresses) > 0,
+		"tag":       r.Tag != "",
+		"sources":   len(r.Sources) > 0,
+		"timestamp": r.Timestamp != "",
+	}
+	for field, ok := range populated {
+		if ok {
+			v.fields[field]++
+		}
+	}
+	for _, a := range r.Addresses {
+		if a.Cidr != "" {
+			v.fields["address cidr"]++
+		}
+		if a.Asn != "" {
+			v.fields["address asn"]++
+		}
+	}
+}
+
+// print writes the validation report to stdout
+func (v *validation) print(filename, format string) {
+	fmt.Printf("File: %s\n", filename)
+	fmt.Printf("Format: %s\n", format)
+	fmt.Printf("Schema: %s\n", v.schema())
+	fmt.Printf("Lines: %d\n", v.lines)
+	fmt.Printf("Results: %d\n", v.results)
+	fmt.Printf("Errors: %d\n", len(v.errors))
+	for i, e := range v.errors {
+		if i == maxValidationErrors {
+			fmt.Printf("  ... and %d more\n", len(v.errors)-maxValidationErrors)
+			break
+		}
+		fmt.Printf("  %s\n", e)
+	}
+	fmt.Println("Populated fields:")
+	fields := []string{}
+	for field := range v.fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		fmt.Printf("  %-14s %d\n", field, v.fields[field])
+	}
+}
+
+// validate implements -validate, it reads and checks the results file without connecting to lair
+func validate(opts options, args []string) error {
+	if len(args) == 0 {
+		return errors.New("setup: missing required argument")
+	}
+	// like a normal run, the filename is always the last argument
+	filename := args[len(args)-1]
+	data, err := readInput(filename, fetchOptions{
+		insecure: opts.insecureSSL,
+		timeout:  opts.timeout,
+		proxy:    opts.proxy,
+		encoding: opts.inputEncoding,
+	})
+	if err != nil {
+		return fmt.Errorf("parse: could not open file: %w", err)
+	}
+	format := opts.format
+	if format == "auto" {
+		format = detectFormat(data)
+	}
+	if format != "json" && format != "text" && format != "db" {
+		return fmt.Errorf("parse: unknown input format %s", format)
+	}
+	v := validateData(data, format, opts.schemaVersion)
+	v.print(redactFilename(filename), format)
+	if len(v.errors) > 0 {
+		return fmt.Errorf("parse: %s has %d lines that could not be parsed", redactFilename(filename), len(v.errors))
+	}
+	return nil
+}
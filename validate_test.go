@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestValidateDataCountsResultLines(t *testing.T) {
+	tests := []struct {
+		format, schemaVersion, data string
+		lines, results, errors      int
+		schema                      string
+	}{
+		{"text", "", "# amass -o names\n\nwww.example.com 1.2.3.4\n  \n# done\napi.example.com 1.2.3.5 1.2.3.0/24 x\n", 2, 1, 1, "text"},
+		{"json", "", `{"name":"a.example.com","sources":["DNS"]}` + "\n\n" + `{"name":"b.example.com","source":"DNS"}` + "\n{bad\n", 3, 2, 1, "mixed"},
+		// -schema-version 2 turns a line that only has the v3 field into an error
+		{"json", "2", `{"name":"a.example.com","sources":["DNS"]}` + "\n" + `{"name":"b.example.com","source":"DNS"}` + "\n", 2, 1, 1, "v2"},
+		{"json", "3", `{"name":"a.example.com","sources":["DNS"]}` + "\n" + `{"name":"b.example.com"}` + "\n", 2, 2, 0, "v3"},
+	}
+	for _, tt := range tests {
+		v := validateData([]byte(tt.data), tt.format, tt.schemaVersion)
+		if v.lines != tt.lines || v.results != tt.results || len(v.errors) != tt.errors || v.schema() != tt.schema {
+			t.Errorf("%s %q: got %d lines, %d results, errors %v and schema %s, want %d, %d, %d and %s", tt.format, tt.schemaVersion,
+				v.lines, v.results, v.errors, v.schema(), tt.lines, tt.results, tt.errors, tt.schema)
+		}
+	}
+}
+
+func TestValidateDataDB(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/amass_db.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := validateData(data, "db", "")
+	// 21 rows and a bad line make 5 names
+	if v.lines != 22 || v.results != 5 || len(v.errors) != 1 || v.fields["addresses"] != 1 || v.fields["address asn"] != 1 {
+		t.Errorf("got %d lines, %d results, errors %v and fields %v", v.lines, v.results, v.errors, v.fields)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// webhookSummary is the payload posted to the -webhook endpoint when a run finishes.
+// it is also the data handed to a -webhook-template, so the field names are part of the template interface
+type webhookSummary struct {
+	Tool              string `json:"tool"`
+	Version           string `json:"version"`
+	ProjectID         string `json:"projectId"`
+	RunID             string `json:"runId,omitempty"`
+	Status            string `json:"status"`
+	Message           string `json:"message"`
+	Results           int    `json:"results"`
+	Hosts             int    `json:"hosts"`
+	Netblocks         int    `json:"netblocks"`
+	HostsNotFound     int    `json:"hostsNotFound"`
+	NetblocksNotFound int    `json:"netblocksNotFound"`
+}
+
+// the -webhook-on values, which outcomes of a run are posted. failure covers partial runs too,
+// so only a clean success goes unreported
+const (
+	webhookAlways  = "always"
+	webhookFailure = "failure"
+	webhookNever   = "never"
+)
+
+// webhook holds the -webhook settings along with the summary of the current run
+type webhook struct {
+	url      string
+	on       string
+	template *template.Template
+	summary  webhookSummary
+}
+
+// wants reports whether a run with this status is posted under -webhook-on
+func (w *webhook) wants(status string) bool {
+	switch w.on {
+	case webhookNever:
+		return false
+	case webhookFailure:
+		return status != "success"
+	}
+	return true
+}
+
+// loadTemplate reads and compiles the -webhook-template file
+func (w *webhook) loadTemplate(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	t, err := template.New("webhook").Parse(string(data))
+	if err != nil {
+		return err
+	}
+	w.template = t
+	return nil
+}
+
+// notify posts the run summary with the given status to the webhook, if one was configured and -webhook-on
+// wants it. this is best effort, errors are logged and never fail the run
+func (w *webhook) notify(status, message string) {
+	if w.url == "" || !w.wants(status) {
+		return
+	}
+	w.summary.Status = status
+	w.summary.Message = message
+	if err := w.post(); err != nil {
+		log.Printf("Warning: Unable to send webhook notification. Error %s", err.Error())
+	}
+}
+
+// post renders the payload (the template if given, otherwise plain json) and sends it
+func (w *webhook) post() error {
+	var payload bytes.Buffer
+	if w.template != nil {
+		if err := w.template.Execute(&payload, w.summary); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&payload).Encode(w.summary); err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(w.url, "application/json", &payload)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// hookServer records the bodies posted to it and answers with status
+func hookServer(t *testing.T, status int) (*httptest.Server, *[]string) {
+	t.Helper()
+	bodies := []string{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got a %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s, &bodies
+}
+
+func TestWebhookPostsSummary(t *testing.T) {
+	s, bodies := hookServer(t, http.StatusOK)
+	w := &webhook{url: s.URL, summary: webhookSummary{Tool: "drone-amass", ProjectID: "p1", Results: 3, Hosts: 2}}
+	w.notify("success", "Operation completed successfully")
+	if len(*bodies) != 1 {
+		t.Fatalf("got %d posts, want 1", len(*bodies))
+	}
+	var got webhookSummary
+	if err := json.Unmarshal([]byte((*bodies)[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := webhookSummary{Tool: "drone-amass", ProjectID: "p1", Status: "success", Message: "Operation completed successfully", Results: 3, Hosts: 2}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	s, bodies := hookServer(t, http.StatusNoContent)
+	filename := filepath.Join(t.TempDir(), "hook.tmpl")
+	if err := ioutil.WriteFile(filename, []byte(`{"text":"{{.ProjectID}} {{.Status}}: {{.Hosts}} hosts"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := &webhook{url: s.URL, summary: webhookSummary{ProjectID: "p1", Hosts: 4}}
+	if err := w.loadTemplate(filename); err != nil {
+		t.Fatal(err)
+	}
+	w.summary.Status = "failure"
+	if err := w.post(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := `{"text":"p1 failure: 4 hosts"}`; len(*bodies) != 1 || (*bodies)[0] != want {
+		t.Errorf("got %q, want %q", *bodies, want)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	s, _ := hookServer(t, http.StatusInternalServerError)
+	w := &webhook{url: s.URL}
+	if err := w.post(); err == nil {
+		t.Fatal("expected an error for a 500 from the webhook")
+	}
+}
+
+func TestWebhookOn(t *testing.T) {
+	s, bodies := hookServer(t, http.StatusOK)
+	for _, on := range []string{webhookAlways, webhookFailure, webhookNever} {
+		w := &webhook{url: s.URL, on: on}
+		for _, status := range []string{"success", "partial", "failure"} {
+			w.notify(status, "")
+		}
+	}
+	// always posts all three, failure the two that weren't clean, never none
+	if len(*bodies) != 5 {
+		t.Errorf("got %d posts, want 5", len(*bodies))
+	}
+}
+
+func TestWebhookWithoutURLDoesNothing(t *testing.T) {
+	w := &webhook{}
+	w.notify("failure", "nothing to post to")
+}